@@ -1,6 +1,8 @@
 package analysis
 
 import (
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/vietmpl/vie/ast"
@@ -8,9 +10,15 @@ import (
 )
 
 type Analyzer struct {
+	// Include returns the template named by an include block, which is then
+	// analyzed in place of the block. Include blocks are skipped if it is
+	// nil.
+	Include func(name string) (*ast.Template, error)
+
 	mu          sync.RWMutex
 	usages      map[string][]Usage
 	diagnostics []Diagnostic
+	macros      map[*ast.MacroBlock]*macro
 }
 
 func NewAnalyzer() *Analyzer {
@@ -18,6 +26,7 @@ func NewAnalyzer() *Analyzer {
 		mu:          sync.RWMutex{},
 		usages:      make(map[string][]Usage),
 		diagnostics: nil,
+		macros:      make(map[*ast.MacroBlock]*macro),
 	}
 }
 
@@ -28,7 +37,7 @@ func (a *Analyzer) Template(template *ast.Template, path string) {
 	c := internalContext{
 		path: path,
 	}
-	a.checkBlocks(c, template.Blocks)
+	a.checkTemplate(c, template)
 }
 
 // Results completes type inference and returns results.
@@ -43,33 +52,140 @@ func (a *Analyzer) Results() (map[string]value.Type, []Diagnostic) {
 	if len(a.usages) == 0 {
 		return nil, a.diagnostics
 	}
-	types := make(map[string]value.Type, len(a.usages))
+	inferred := make(map[TypeVar]value.Type, len(a.usages))
 	for name, uses := range a.usages {
-		var typeCount [value.TypeFunction]uint
-		for _, u := range uses {
-			typeCount[u.Type]++
-		}
-
-		var maxType value.Type
-		var maxCount uint
-		for t, c := range typeCount {
-			if c > maxCount {
-				maxType, maxCount = value.Type(t), c
-			}
-		}
-
-		types[name] = maxType
+		maxType := vote(uses)
+		inferred[TypeVar(name)] = maxType
 
 		for _, u := range uses {
-			if u.Type != maxType {
+			if !accepts(u, maxType) {
 				a.addDiagnostic(WrongUsage{
 					WantType: u.Type,
 					GotType:  maxType,
 					Pos_:     u.Pos,
+					End_:     u.End,
 					Path_:    u.Path,
 				})
 			}
 		}
 	}
+
+	fields := make(map[TypeVar][]TypeVar)
+	for tv := range inferred {
+		if parent, _, ok := tv.fieldName(); ok {
+			fields[parent] = append(fields[parent], tv)
+		}
+	}
+
+	types := make(map[string]value.Type, len(inferred))
+	for tv := range inferred {
+		if tv.isRoot() {
+			types[tv.String()] = composeType(inferred, fields, tv)
+		}
+	}
 	return types, a.diagnostics
 }
+
+// vote returns the type used by most of uses.
+func vote(uses []Usage) value.Type {
+	// Display blocks and the in operator accept several types, so their
+	// usages only decide the type when there are no other usages.
+	votes := slices.DeleteFunc(slices.Clone(uses), isLoose)
+	if len(votes) == 0 {
+		votes = uses
+	}
+
+	// Ties are resolved in favor of the type that was used first to keep
+	// results deterministic.
+	typeCount := make(map[value.Type]uint)
+	var order []value.Type
+	for _, u := range votes {
+		if typeCount[u.Type] == 0 {
+			order = append(order, u.Type)
+		}
+		typeCount[u.Type]++
+	}
+
+	var maxType value.Type
+	var maxCount uint
+	for _, t := range order {
+		if c := typeCount[t]; c > maxCount {
+			maxType, maxCount = t, c
+		}
+	}
+	return maxType
+}
+
+// inferredType returns the complete type of tv inferred from the usages
+// recorded so far, or nil if tv is not used.
+func (a *Analyzer) inferredType(tv TypeVar) value.Type {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	inferred := make(map[TypeVar]value.Type)
+	fields := make(map[TypeVar][]TypeVar)
+	for name, uses := range a.usages {
+		v := TypeVar(name)
+		if v != tv && !strings.HasPrefix(name, string(tv+elemSuffix)) &&
+			!strings.HasPrefix(name, string(tv+fieldSeparator)) {
+			continue
+		}
+		inferred[v] = vote(uses)
+		if parent, _, ok := v.fieldName(); ok {
+			fields[parent] = append(fields[parent], v)
+		}
+	}
+	if _, ok := inferred[tv]; !ok {
+		return nil
+	}
+	return composeType(inferred, fields, tv)
+}
+
+// composeType builds the complete type of tv from the types inferred for it
+// and for its elements or fields.
+func composeType(inferred map[TypeVar]value.Type, fields map[TypeVar][]TypeVar, tv TypeVar) value.Type {
+	switch t := inferred[tv].(type) {
+	case value.ListType:
+		if _, ok := inferred[tv.elem()]; ok {
+			t.Elem = composeType(inferred, fields, tv.elem())
+		}
+		return t
+	case value.MapType:
+		if len(fields[tv]) > 0 {
+			fieldTypes := make(map[string]value.Type, len(fields[tv]))
+			for _, field := range fields[tv] {
+				_, name, _ := field.fieldName()
+				fieldTypes[name] = composeType(inferred, fields, field)
+			}
+			t.Fields = &fieldTypes
+		}
+		return t
+	default:
+		return t
+	}
+}
+
+// isLoose reports whether u accepts other types than its own.
+func isLoose(u Usage) bool {
+	switch u.Kind {
+	case UsageKindRender, UsageKindIn, UsageKindInElement:
+		return true
+	default:
+		return false
+	}
+}
+
+// accepts reports whether a variable of type t satisfies u.
+func accepts(u Usage, t value.Type) bool {
+	switch u.Kind {
+	case UsageKindRender:
+		return u.Type == t || displayable(t)
+	case UsageKindIn:
+		_, ok := t.(value.ListType)
+		return ok || t == value.TypeString
+	case UsageKindInElement:
+		return true
+	default:
+		return u.Type == t
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/vietmpl/vie/analysis"
+	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/parse"
 	"github.com/vietmpl/vie/value"
 )
@@ -24,6 +25,197 @@ func TestTypes(t *testing.T) {
 				"name": value.TypeString,
 			},
 		},
+		{
+			input: "{% for x in xs %}{{ x }}{% else %}{{ name }}{% end %}",
+			typemap: map[string]value.Type{
+				"xs":   value.ListType{Elem: value.TypeString},
+				"name": value.TypeString,
+			},
+		},
+		{
+			input: "{% for x in xs %}{% end %}",
+			typemap: map[string]value.Type{
+				"xs": value.ListType{},
+			},
+		},
+		{
+			input: "{% for row in rows %}{% for x in row %}{{ x }}{% end %}{% end %}",
+			typemap: map[string]value.Type{
+				"rows": value.ListType{Elem: value.ListType{Elem: value.TypeString}},
+			},
+		},
+		{
+			input: "{{ @join(fields, sep) }}",
+			typemap: map[string]value.Type{
+				"fields": value.ListType{Elem: value.TypeString},
+				"sep":    value.TypeString,
+			},
+		},
+		{
+			input: "{{ entity.name }}{% if entity.meta.exported %}{% end %}",
+			typemap: map[string]value.Type{
+				"entity": value.MapType{Fields: &map[string]value.Type{
+					"name": value.TypeString,
+					"meta": value.MapType{Fields: &map[string]value.Type{
+						"exported": value.TypeBool,
+					}},
+				}},
+			},
+		},
+		{
+			input: "{% for f in fields %}{{ f.name }}{% if loop.last %}{% end %}{% end %}",
+			typemap: map[string]value.Type{
+				"fields": value.ListType{Elem: value.MapType{Fields: &map[string]value.Type{
+					"name": value.TypeString,
+				}}},
+			},
+		},
+		{
+			input: "{{ count }}{% if count > 1 %}s{% end %}",
+			typemap: map[string]value.Type{
+				"count": value.TypeInt,
+			},
+		},
+		{
+			input: "{{ port + 1 }}{% if name < \"m\" %}{% end %}",
+			typemap: map[string]value.Type{
+				"port": value.TypeInt,
+				"name": value.TypeString,
+			},
+		},
+		{
+			input: "{{ @len(xs) }}",
+			typemap: map[string]value.Type{
+				"xs": value.ListType{},
+			},
+		},
+		{
+			input: "{% for x in [\"a\", b] %}{{ x }}{% end %}",
+			typemap: map[string]value.Type{
+				"b": value.TypeString,
+			},
+		},
+		{
+			input: "{% macro field(f, exported) %}{% if exported %}{{ f.name | @pascal }}{% end %}{% end %}" +
+				"{% for f in fields %}{{ field(f, public) }}{% end %}",
+			typemap: map[string]value.Type{
+				"fields": value.ListType{Elem: value.MapType{Fields: &map[string]value.Type{
+					"name": value.TypeString,
+				}}},
+				"public": value.TypeBool,
+			},
+		},
+		{
+			input: "{{ name }}{% raw %}{{ values.image }}{% end %}",
+			typemap: map[string]value.Type{
+				"name": value.TypeString,
+			},
+		},
+		{
+			input: "{% set n = name | @pascal %}{{ n }}{% set e = exported %}{% if e %}{{ n }}{% end %}",
+			typemap: map[string]value.Type{
+				"name":     value.TypeString,
+				"exported": value.TypeBool,
+			},
+		},
+		{
+			input: "{% for x in xs %}{% set y = x %}{{ y }}{% end %}{{ y }}",
+			typemap: map[string]value.Type{
+				"xs": value.ListType{Elem: value.TypeString},
+				"y":  value.TypeString,
+			},
+		},
+		{
+			input: "{{ name | quote }}{% macro quote(s) %}\"{{ s }}\"{{ suffix }}{% end %}",
+			typemap: map[string]value.Type{
+				"name":   value.TypeString,
+				"suffix": value.TypeString,
+			},
+		},
+		{
+			input: "{% if \"/internal/\" in path and 1 not in ns and k in [\"a\"] %}{{ path }}{% end %}",
+			typemap: map[string]value.Type{
+				"path": value.TypeString,
+				"ns":   value.ListType{Elem: value.TypeInt},
+				"k":    value.TypeString,
+			},
+		},
+		{
+			input: "{% if \"x\" in l %}{% end %}{% if x in m %}{% end %}",
+			typemap: map[string]value.Type{
+				"l": value.TypeString,
+				"x": value.TypeString,
+				"m": value.TypeString,
+			},
+		},
+		{
+			input: "{% if x in roles %}{% end %}{% for r in roles %}{% end %}",
+			typemap: map[string]value.Type{
+				"roles": value.ListType{},
+				"x":     value.TypeString,
+			},
+		},
+		{
+			input: "{{ name | @replace(old, \"_\") }}",
+			typemap: map[string]value.Type{
+				"name": value.TypeString,
+				"old":  value.TypeString,
+			},
+		},
+		{
+			input: "{{ name | @upper(\"x\") }}",
+			diagnostics: []analysis.Diagnostic{
+				analysis.IncorrectArgCount{
+					FuncName: "@upper",
+					Want:     1,
+					Got:      2,
+					Piped:    true,
+					Pos_:     ast.Location{Line: 0, Column: 17, Offset: 17},
+					End_:     ast.Location{Line: 0, Column: 20, Offset: 20},
+				},
+			},
+		},
+		{
+			input: "{% switch db %}{% case \"pg\", \"mysql\" %}{% case \"pg\" %}{% end %}",
+			typemap: map[string]value.Type{
+				"db": value.TypeString,
+			},
+			diagnostics: []analysis.Diagnostic{
+				analysis.DuplicateCase{
+					Value: "\"pg\"",
+					Pos_:  ast.Location{Line: 0, Column: 47, Offset: 47},
+					End_:  ast.Location{Line: 0, Column: 51, Offset: 51},
+				},
+			},
+		},
+		{
+			input: "{% switch port %}{% case 80 %}{{ \"http\" }}{% default %}{{ port }}{% end %}",
+			typemap: map[string]value.Type{
+				"port": value.TypeInt,
+			},
+		},
+		{
+			input: "{{ exported ? name | @pascal : other }}",
+			typemap: map[string]value.Type{
+				"exported": value.TypeBool,
+				"name":     value.TypeString,
+				"other":    value.TypeString,
+			},
+		},
+		{
+			input: "{{ a ? \"x\" : 1 }}",
+			typemap: map[string]value.Type{
+				"a": value.TypeBool,
+			},
+			diagnostics: []analysis.Diagnostic{
+				analysis.InvalidOperation{
+					X:    value.TypeString,
+					Y:    value.TypeInt,
+					Pos_: ast.Location{Line: 0, Column: 3, Offset: 3},
+					End_: ast.Location{Line: 0, Column: 14, Offset: 14},
+				},
+			},
+		},
 	}
 
 	for _, testCase := range cases {
@@ -39,7 +231,7 @@ func TestTypes(t *testing.T) {
 			analyzer.Template(f, "")
 			typemap, diagnostics := analyzer.Results()
 
-			if !maps.Equal(testCase.typemap, typemap) {
+			if !maps.EqualFunc(testCase.typemap, typemap, sameType) {
 				t.Errorf("expected %v, got %v", testCase.typemap, typemap)
 			}
 
@@ -49,3 +241,81 @@ func TestTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestInclude(t *testing.T) {
+	t.Parallel()
+
+	partials := map[string]string{
+		"header.vie": "{{ name }}{% if exported %}{% end %}",
+		"cycle.vie":  "{% include \"cycle.vie\" %}",
+	}
+	analyzer := analysis.NewAnalyzer()
+	analyzer.Include = func(name string) (*ast.Template, error) {
+		return parse.Source([]byte(partials[name]))
+	}
+
+	f, err := parse.Source([]byte("{% include \"header.vie\" %}{% include \"cycle.vie\" %}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer.Template(f, "main.vie")
+	typemap, diagnostics := analyzer.Results()
+
+	expected := map[string]value.Type{
+		"name":     value.TypeString,
+		"exported": value.TypeBool,
+	}
+	if !maps.EqualFunc(expected, typemap, sameType) {
+		t.Errorf("expected %v, got %v", expected, typemap)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected an include cycle diagnostic, got %v", diagnostics)
+	}
+	if _, ok := diagnostics[0].(analysis.IncludeError); !ok {
+		t.Errorf("expected an include error, got %T", diagnostics[0])
+	}
+}
+
+func TestExtends(t *testing.T) {
+	t.Parallel()
+
+	base, err := parse.Source([]byte("{% block title %}{{ name }}{% end %}{% block body %}{% end %}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parse.Source([]byte("{% extends \"base.vie\" %}{% block body %}{% if exported %}{% end %}{% end %}{% block footer %}{% end %}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Extends().Base = base
+
+	analyzer := analysis.NewAnalyzer()
+	analyzer.Template(f, "child.vie")
+	typemap, diagnostics := analyzer.Results()
+
+	expected := map[string]value.Type{
+		"name":     value.TypeString,
+		"exported": value.TypeBool,
+	}
+	if !maps.EqualFunc(expected, typemap, sameType) {
+		t.Errorf("expected %v, got %v", expected, typemap)
+	}
+	expectedDiagnostics := []analysis.Diagnostic{
+		analysis.UnknownBlock{
+			Name:  "footer",
+			Base:  "base.vie",
+			Pos_:  f.Blocks[2].(*ast.NamedBlock).Name.Start(),
+			End_:  f.Blocks[2].(*ast.NamedBlock).Name.End(),
+			Path_: "child.vie",
+		},
+	}
+	if !slices.Equal(expectedDiagnostics, diagnostics) {
+		t.Errorf("expected %v, got %v", expectedDiagnostics, diagnostics)
+	}
+}
+
+// sameType reports whether x and y are the same type, comparing the fields of
+// maps by value.
+func sameType(x, y value.Type) bool {
+	return x.String() == y.String()
+}
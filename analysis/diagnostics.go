@@ -4,12 +4,16 @@ import (
 	"fmt"
 
 	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/token"
 	"github.com/vietmpl/vie/value"
 )
 
 type Diagnostic interface {
 	String() string
 	Pos() ast.Location
+	// End returns the location immediately after the source range of the
+	// diagnostic, which starts at Pos.
+	End() ast.Location
 	Path() string
 }
 
@@ -17,6 +21,7 @@ type WrongUsage struct {
 	WantType value.Type
 	GotType  value.Type
 	Pos_     ast.Location
+	End_     ast.Location
 	Path_    string
 }
 
@@ -28,6 +33,10 @@ func (d WrongUsage) Pos() ast.Location {
 	return d.Pos_
 }
 
+func (d WrongUsage) End() ast.Location {
+	return d.End_
+}
+
 func (d WrongUsage) Path() string {
 	return d.Path_
 }
@@ -36,6 +45,7 @@ type InvalidOperation struct {
 	X     value.Type
 	Y     value.Type
 	Pos_  ast.Location
+	End_  ast.Location
 	Path_ string
 }
 
@@ -48,14 +58,43 @@ func (d InvalidOperation) Pos() ast.Location {
 	return d.Pos_
 }
 
+func (d InvalidOperation) End() ast.Location {
+	return d.End_
+}
+
 func (d InvalidOperation) Path() string {
 	return d.Path_
 }
 
+type UndefinedOperator struct {
+	Operator token.Kind
+	Type     value.Type
+	Pos_     ast.Location
+	End_     ast.Location
+	Path_    string
+}
+
+func (d UndefinedOperator) String() string {
+	return fmt.Sprintf("invalid operation: operator %s not defined on %s", d.Operator, d.Type)
+}
+
+func (d UndefinedOperator) Pos() ast.Location {
+	return d.Pos_
+}
+
+func (d UndefinedOperator) End() ast.Location {
+	return d.End_
+}
+
+func (d UndefinedOperator) Path() string {
+	return d.Path_
+}
+
 type CrossVarTyping struct {
 	X     TypeVar
 	Y     TypeVar
 	Pos_  ast.Location
+	End_  ast.Location
 	Path_ string
 }
 
@@ -67,6 +106,10 @@ func (d CrossVarTyping) Pos() ast.Location {
 	return d.Pos_
 }
 
+func (d CrossVarTyping) End() ast.Location {
+	return d.End_
+}
+
 func (d CrossVarTyping) Path() string {
 	return d.Path_
 }
@@ -75,6 +118,7 @@ type BuiltinNotFound struct {
 	Name  string
 	Msg   string
 	Pos_  ast.Location
+	End_  ast.Location
 	Path_ string
 }
 
@@ -86,6 +130,10 @@ func (d BuiltinNotFound) Pos() ast.Location {
 	return d.Pos_
 }
 
+func (d BuiltinNotFound) End() ast.Location {
+	return d.End_
+}
+
 func (d BuiltinNotFound) Path() string {
 	return d.Path_
 }
@@ -94,11 +142,18 @@ type IncorrectArgCount struct {
 	FuncName string
 	Want     int
 	Got      int
-	Pos_     ast.Location
-	Path_    string
+	// Piped is set if the function is called by a pipe, whose piped value
+	// is counted as the first argument.
+	Piped bool
+	Pos_  ast.Location
+	End_  ast.Location
+	Path_ string
 }
 
 func (d IncorrectArgCount) String() string {
+	if d.Piped {
+		return fmt.Sprintf("function %q expects %d argument(s), but %d were provided (including the piped value)", d.FuncName, d.Want, d.Got)
+	}
 	return fmt.Sprintf("function %q expects %d argument(s), but %d were provided", d.FuncName, d.Want, d.Got)
 }
 
@@ -106,6 +161,104 @@ func (d IncorrectArgCount) Pos() ast.Location {
 	return d.Pos_
 }
 
+func (d IncorrectArgCount) End() ast.Location {
+	return d.End_
+}
+
 func (d IncorrectArgCount) Path() string {
 	return d.Path_
 }
+
+type UnknownField struct {
+	Name  string
+	Type  value.MapType
+	Pos_  ast.Location
+	End_  ast.Location
+	Path_ string
+}
+
+func (d UnknownField) String() string {
+	return fmt.Sprintf("%s has no field %s", d.Type, d.Name)
+}
+
+func (d UnknownField) Pos() ast.Location {
+	return d.Pos_
+}
+
+func (d UnknownField) End() ast.Location {
+	return d.End_
+}
+
+func (d UnknownField) Path() string {
+	return d.Path_
+}
+
+type IncludeError struct {
+	Msg   string
+	Pos_  ast.Location
+	End_  ast.Location
+	Path_ string
+}
+
+func (d IncludeError) String() string {
+	return d.Msg
+}
+
+func (d IncludeError) Pos() ast.Location {
+	return d.Pos_
+}
+
+func (d IncludeError) End() ast.Location {
+	return d.End_
+}
+
+func (d IncludeError) Path() string {
+	return d.Path_
+}
+
+type UnknownBlock struct {
+	Name  string
+	Base  string
+	Pos_  ast.Location
+	End_  ast.Location
+	Path_ string
+}
+
+func (d UnknownBlock) String() string {
+	return fmt.Sprintf("block %s is not defined in %s", d.Name, d.Base)
+}
+
+func (d UnknownBlock) Pos() ast.Location {
+	return d.Pos_
+}
+
+func (d UnknownBlock) End() ast.Location {
+	return d.End_
+}
+
+func (d UnknownBlock) Path() string {
+	return d.Path_
+}
+
+type DuplicateCase struct {
+	Value string
+	Pos_  ast.Location
+	End_  ast.Location
+	Path_ string
+}
+
+func (d DuplicateCase) String() string {
+	return fmt.Sprintf("duplicate case %s in switch", d.Value)
+}
+
+func (d DuplicateCase) Pos() ast.Location {
+	return d.Pos_
+}
+
+func (d DuplicateCase) End() ast.Location {
+	return d.End_
+}
+
+func (d DuplicateCase) Path() string {
+	return d.Path_
+}
@@ -2,6 +2,9 @@ package analysis
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/builtin"
@@ -9,12 +12,124 @@ import (
 	"github.com/vietmpl/vie/value"
 )
 
+// loopVariable is the name of the map holding metadata about the current
+// iteration of a for loop, and loopType is its type.
+const loopVariable = "loop"
+
+var loopType = value.MapType{Fields: &map[string]value.Type{
+	"index": value.TypeInt,
+	"first": value.TypeBool,
+	"last":  value.TypeBool,
+}}
+
 type internalContext struct {
 	path string
+	// locals maps names bound inside the template, such as loop variables,
+	// to their types. A nil type means the local could not be typed.
+	locals map[string]any
+	// includes holds the names of the templates being included, innermost
+	// last.
+	includes []string
+	// overrides maps the names of named blocks to the blocks overriding
+	// them in templates extending the one being checked.
+	overrides map[string]override
+	// macros maps the names of the macros available to the template being
+	// checked to their definitions.
+	macros map[string]*macro
+}
+
+// override is a named block of an extending template, found in the file
+// path.
+type override struct {
+	block *ast.NamedBlock
+	path  string
+}
+
+// withLocal returns a copy of c in which name is bound to type t, shadowing
+// any variable with the same name.
+func (c internalContext) withLocal(name string, t any) internalContext {
+	locals := make(map[string]any, len(c.locals)+1)
+	maps.Copy(locals, c.locals)
+	locals[name] = t
+	c.locals = locals
+	return c
+}
+
+// checkTemplate checks the blocks of t. A template extending another one is
+// checked as its base template, with the named blocks of t in place of those
+// of the base.
+func (a *Analyzer) checkTemplate(c internalContext, t *ast.Template) {
+	c.overrides = nil
+	macros := make(map[string]*macro)
+	var bases []*ast.Template
+	for extends := t.Extends(); extends != nil && extends.Base != nil; extends = t.Extends() {
+		if slices.Contains(bases, extends.Base) {
+			break
+		}
+		bases = append(bases, extends.Base)
+		baseName := string(value.FromBasicLit(&extends.Path).(value.String))
+		a.collectMacros(c, t, macros)
+
+		// Blocks can be overridden if any of the ancestors defines them.
+		defined := make(map[string]bool)
+		var ancestors []*ast.Template
+		for base := extends.Base; base != nil && !slices.Contains(ancestors, base); {
+			ancestors = append(ancestors, base)
+			for name := range ast.NamedBlocks(base.Blocks) {
+				defined[name] = true
+			}
+			if next := base.Extends(); next != nil {
+				base = next.Base
+			} else {
+				base = nil
+			}
+		}
+
+		named := ast.NamedBlocks(t.Blocks)
+		// Blocks nested in an overriding block are new blocks rather than
+		// overrides.
+		nested := make(map[string]bool)
+		for _, block := range named {
+			for name := range ast.NamedBlocks(block.Body) {
+				nested[name] = true
+			}
+		}
+		if c.overrides == nil {
+			c.overrides = make(map[string]override, len(named))
+		}
+		for _, name := range slices.Sorted(maps.Keys(named)) {
+			block := named[name]
+			if !defined[name] && !nested[name] {
+				a.addDiagnostic(UnknownBlock{
+					Name:  name,
+					Base:  baseName,
+					Pos_:  block.Name.Start(),
+					End_:  block.Name.End(),
+					Path_: c.path,
+				})
+			}
+			// Blocks of the most derived template take precedence.
+			if _, ok := c.overrides[name]; !ok {
+				c.overrides[name] = override{block: block, path: c.path}
+			}
+		}
+
+		c.path = baseName
+		t = extends.Base
+	}
+	a.collectMacros(c, t, macros)
+	c.macros = a.defineMacros(c, macros)
+	a.checkBlocks(c, t.Blocks)
 }
 
 func (a *Analyzer) checkBlocks(c internalContext, blocks []ast.Block) {
 	for _, b := range blocks {
+		// Variables bound by set blocks are locals of the following blocks
+		// and not part of the template context.
+		if set, ok := b.(*ast.SetBlock); ok {
+			c = c.withLocal(set.Name.Value, a.checkExpr(c, set.Value))
+			continue
+		}
 		a.checkBlock(c, b)
 	}
 }
@@ -25,17 +140,20 @@ func (a *Analyzer) checkBlock(c internalContext, block ast.Block) {
 		// Skip
 	case *ast.CommentBlock:
 		// Skip
+	case *ast.RawBlock:
+		// Skip
 	case *ast.DisplayBlock:
 		x := a.checkExpr(c, b.Value)
 		switch xx := x.(type) {
 		case nil:
 			return
 		case value.Type:
-			if xx != value.TypeString {
+			if !displayable(xx) {
 				a.addDiagnostic(WrongUsage{
 					WantType: value.TypeString,
 					GotType:  xx,
 					Pos_:     b.Value.Start(),
+					End_:     b.Value.End(),
 					Path_:    c.path,
 				})
 			}
@@ -44,6 +162,7 @@ func (a *Analyzer) checkBlock(c internalContext, block ast.Block) {
 				Type: value.TypeString,
 				Kind: UsageKindRender,
 				Pos:  b.Value.Start(),
+				End:  b.Value.End(),
 				Path: c.path,
 			})
 		}
@@ -60,6 +179,7 @@ func (a *Analyzer) checkBlock(c internalContext, block ast.Block) {
 						WantType: value.TypeBool,
 						GotType:  conditionx,
 						Pos_:     branch.Condition.Start(),
+						End_:     branch.Condition.End(),
 						Path_:    c.path,
 					})
 				}
@@ -68,6 +188,7 @@ func (a *Analyzer) checkBlock(c internalContext, block ast.Block) {
 					Type: value.TypeBool,
 					Kind: UsageKindIf,
 					Pos:  branch.Condition.Start(),
+					End:  branch.Condition.End(),
 					Path: c.path,
 				})
 			}
@@ -77,11 +198,151 @@ func (a *Analyzer) checkBlock(c internalContext, block ast.Block) {
 			a.checkBlocks(c, *b.Alternative)
 		}
 
+	case *ast.SwitchBlock:
+		a.checkSwitch(c, b)
+
+	case *ast.ForBlock:
+		// The loop variable takes the element type of the iterable. It is
+		// left untyped if the element type is unknown.
+		var elem any
+		switch iterable := a.checkExpr(c, b.Iterable).(type) {
+		case nil:
+		case value.Type:
+			if list, ok := iterable.(value.ListType); ok {
+				if list.Elem != nil {
+					elem = list.Elem
+				}
+			} else {
+				a.addDiagnostic(WrongUsage{
+					WantType: value.ListType{},
+					GotType:  iterable,
+					Pos_:     b.Iterable.Start(),
+					End_:     b.Iterable.End(),
+					Path_:    c.path,
+				})
+			}
+		case TypeVar:
+			a.addUsage(iterable.String(), Usage{
+				Type: value.ListType{},
+				Kind: UsageKindFor,
+				Pos:  b.Iterable.Start(),
+				End:  b.Iterable.End(),
+				Path: c.path,
+			})
+			elem = iterable.elem()
+		}
+		body := c.withLocal(loopVariable, loopType).withLocal(b.Variable.Value, elem)
+		a.checkBlocks(body, b.Body)
+		if b.Alternative != nil {
+			a.checkBlocks(c, *b.Alternative)
+		}
+
+	case *ast.IncludeBlock:
+		if a.Include == nil {
+			return
+		}
+		name := string(value.FromBasicLit(&b.Path).(value.String))
+		if slices.Contains(c.includes, name) {
+			a.addDiagnostic(IncludeError{
+				Msg:   fmt.Sprintf("include cycle: %s -> %s", strings.Join(c.includes, " -> "), name),
+				Pos_:  b.Path.Start(),
+				End_:  b.Path.End(),
+				Path_: c.path,
+			})
+			return
+		}
+		template, err := a.Include(name)
+		if err != nil {
+			a.addDiagnostic(IncludeError{
+				Msg:   err.Error(),
+				Pos_:  b.Path.Start(),
+				End_:  b.Path.End(),
+				Path_: c.path,
+			})
+			return
+		}
+		// Variables of the including template stay visible in the included
+		// one.
+		included := c
+		included.path = name
+		included.includes = append(slices.Clip(c.includes), name)
+		a.checkTemplate(included, template)
+
+	case *ast.ExtendsBlock:
+		// Templates extending another one are checked by checkTemplate.
+
+	case *ast.SetBlock:
+		// Set blocks are checked by checkBlocks.
+
+	case *ast.MacroBlock, *ast.ImportBlock:
+		// Macros are checked by checkTemplate.
+
+	case *ast.NamedBlock:
+		if o, ok := c.overrides[b.Name.Value]; ok && o.block != b {
+			c.path = o.path
+			a.checkBlocks(c, o.block.Body)
+			return
+		}
+		a.checkBlocks(c, b.Body)
+
 	default:
 		panic(fmt.Sprintf("analyzer: unexpected block type %T", block))
 	}
 }
 
+// checkSwitch checks that the case values of b have the type of the
+// switched value, inferring the type of a switched variable from them, and
+// reports duplicate literal cases.
+func (a *Analyzer) checkSwitch(c internalContext, b *ast.SwitchBlock) {
+	switched := a.checkExpr(c, b.Value)
+	seen := make(map[value.Value]bool)
+	for _, switchCase := range b.Cases {
+		for _, e := range switchCase.Values {
+			if lit, ok := e.(*ast.BasicLiteral); ok {
+				key := value.FromBasicLit(lit)
+				if seen[key] {
+					a.addDiagnostic(DuplicateCase{
+						Value: lit.Value,
+						Pos_:  lit.Start(),
+						End_:  lit.End(),
+						Path_: c.path,
+					})
+				}
+				seen[key] = true
+			}
+
+			x := a.checkExpr(c, e)
+			if switched == nil || x == nil {
+				continue
+			}
+			switch switchedx := switched.(type) {
+			case value.Type:
+				a.expectType(x, Usage{
+					Type: switchedx,
+					Kind: UsageKindSwitch,
+					Pos:  e.Start(),
+					End:  e.End(),
+					Path: c.path,
+				})
+			case TypeVar:
+				if xx, ok := x.(value.Type); ok {
+					a.expectType(switchedx, Usage{
+						Type: xx,
+						Kind: UsageKindSwitch,
+						Pos:  e.Start(),
+						End:  e.End(),
+						Path: c.path,
+					})
+				}
+			}
+		}
+		a.checkBlocks(c, switchCase.Body)
+	}
+	if b.Default != nil {
+		a.checkBlocks(c, *b.Default)
+	}
+}
+
 // checkExpr inspects an expression node and determines its resulting type
 // or variable reference. It returns either a `value.Type` (for literals or
 // known expressions) or a `VarType` (for identifiers whose type is inferred
@@ -96,11 +357,16 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 			return value.TypeBool
 		case ast.KindString:
 			return value.TypeString
+		case ast.KindInt:
+			return value.TypeInt
 		default:
 			panic(fmt.Sprintf("analyzer: unexpected BasicLit kind %d", e.Kind))
 		}
 
 	case *ast.Identifier:
+		if t, ok := c.locals[e.Value]; ok {
+			return t
+		}
 		return TypeVar(e.Value)
 
 	case *ast.UnaryExpr:
@@ -108,14 +374,31 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 		if x == nil {
 			return nil
 		}
-		// The '!' and 'not' operators can only be applied to boolean values
-		a.expectType(x, Usage{
-			Type: value.TypeBool,
-			Kind: UsageKindUnOp,
-			Pos:  e.Operand.Start(),
-			Path: c.path,
-		})
-		return value.TypeBool
+		switch e.Operator {
+		case token.BANG:
+			// The '!' and 'not' operators can only be applied to boolean values
+			a.expectType(x, Usage{
+				Type: value.TypeBool,
+				Kind: UsageKindUnOp,
+				Pos:  e.Operand.Start(),
+				End:  e.Operand.End(),
+				Path: c.path,
+			})
+			return value.TypeBool
+
+		case token.MINUS:
+			a.expectType(x, Usage{
+				Type: value.TypeInt,
+				Kind: UsageKindUnOp,
+				Pos:  e.Operand.Start(),
+				End:  e.Operand.End(),
+				Path: c.path,
+			})
+			return value.TypeInt
+
+		default:
+			panic(fmt.Sprintf("analyzer: unexpected unary operator: %s", e.Operator))
+		}
 
 	case *ast.BinaryExpr:
 		switch e.Operator {
@@ -130,22 +413,63 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 				Type: value.TypeString,
 				Kind: UsageKindBinOp,
 				Pos:  e.LOperand.Start(),
+				End:  e.LOperand.End(),
 				Path: c.path,
 			})
 			a.expectType(y, Usage{
 				Type: value.TypeString,
 				Kind: UsageKindBinOp,
 				Pos:  e.ROperand.Start(),
+				End:  e.ROperand.End(),
 				Path: c.path,
 			})
 			return value.TypeString
 
-		case token.EQUAL_EQUAL, token.BANG_EQUAL:
+		case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT:
+			x := a.checkExpr(c, e.LOperand)
+			y := a.checkExpr(c, e.ROperand)
+			if x == nil || y == nil {
+				return nil
+			}
+
+			a.expectType(x, Usage{
+				Type: value.TypeInt,
+				Kind: UsageKindBinOp,
+				Pos:  e.LOperand.Start(),
+				End:  e.LOperand.End(),
+				Path: c.path,
+			})
+			a.expectType(y, Usage{
+				Type: value.TypeInt,
+				Kind: UsageKindBinOp,
+				Pos:  e.ROperand.Start(),
+				End:  e.ROperand.End(),
+				Path: c.path,
+			})
+			return value.TypeInt
+
+		case token.EQUAL_EQUAL, token.BANG_EQUAL,
+			token.LESS, token.LESS_EQUAL, token.GREATER, token.GREATER_EQUAL:
 			x := a.checkExpr(c, e.LOperand)
 			y := a.checkExpr(c, e.ROperand)
 			if x == nil || y == nil {
 				return nil
 			}
+			if isOrdering(e.Operator) {
+				// Only integers and strings can be ordered.
+				for _, operand := range [...]any{x, y} {
+					if t, ok := operand.(value.Type); ok && t != value.TypeInt && t != value.TypeString {
+						a.addDiagnostic(UndefinedOperator{
+							Operator: e.Operator,
+							Type:     t,
+							Pos_:     e.Start(),
+							End_:     e.End(),
+							Path_:    c.path,
+						})
+						return value.TypeBool
+					}
+				}
+			}
 			// TODO(skewb1k): refactor.
 			switch xx := x.(type) {
 			case value.Type:
@@ -158,6 +482,7 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 							X:     xx,
 							Y:     yy,
 							Pos_:  e.Start(),
+							End_:  e.End(),
 							Path_: c.path,
 						})
 					}
@@ -167,6 +492,7 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 						Type: xx,
 						Kind: UsageKindBinOp,
 						Pos:  e.Start(),
+						End:  e.End(),
 						Path: c.path,
 					})
 				}
@@ -178,6 +504,7 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 						Type: yy,
 						Kind: UsageKindBinOp,
 						Pos:  e.Start(),
+						End:  e.End(),
 						Path: c.path,
 					})
 				// <var> is <var>
@@ -186,12 +513,22 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 						X:     xx,
 						Y:     yy,
 						Pos_:  e.Start(),
+						End_:  e.End(),
 						Path_: c.path,
 					})
 				}
 			}
 			return value.TypeBool
 
+		case token.KEYWORD_IN, token.NOT_IN:
+			x := a.checkExpr(c, e.LOperand)
+			y := a.checkExpr(c, e.ROperand)
+			if x == nil || y == nil {
+				return nil
+			}
+			a.checkIn(c, e, x, y)
+			return value.TypeBool
+
 		case token.KEYWORD_AND, token.KEYWORD_OR:
 			x := a.checkExpr(c, e.LOperand)
 			y := a.checkExpr(c, e.ROperand)
@@ -203,12 +540,14 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 				Type: value.TypeBool,
 				Kind: UsageKindBinOp,
 				Pos:  e.LOperand.Start(),
+				End:  e.LOperand.End(),
 				Path: c.path,
 			})
 			a.expectType(y, Usage{
 				Type: value.TypeBool,
 				Kind: UsageKindBinOp,
 				Pos:  e.ROperand.Start(),
+				End:  e.ROperand.End(),
 				Path: c.path,
 			})
 			return value.TypeBool
@@ -220,43 +559,198 @@ func (a *Analyzer) checkExpr(c internalContext, expr ast.Expr) any {
 	case *ast.ParenExpr:
 		return a.checkExpr(c, e.Value)
 
+	case *ast.MemberExpr:
+		switch x := a.checkExpr(c, e.Object).(type) {
+		case value.Type:
+			m, ok := x.(value.MapType)
+			if !ok {
+				a.addDiagnostic(WrongUsage{
+					WantType: value.MapType{},
+					GotType:  x,
+					Pos_:     e.Object.Start(),
+					End_:     e.Object.End(),
+					Path_:    c.path,
+				})
+				return nil
+			}
+			if m.Fields == nil {
+				return nil
+			}
+			t, ok := (*m.Fields)[e.Member.Value]
+			if !ok {
+				a.addDiagnostic(UnknownField{
+					Name:  e.Member.Value,
+					Type:  m,
+					Pos_:  e.Member.Start(),
+					End_:  e.Member.End(),
+					Path_: c.path,
+				})
+				return nil
+			}
+			return t
+		case TypeVar:
+			a.addUsage(x.String(), Usage{
+				Type: value.MapType{},
+				Kind: UsageKindMember,
+				Pos:  e.Object.Start(),
+				End:  e.Object.End(),
+				Path: c.path,
+			})
+			return x.field(e.Member.Value)
+		default:
+			return nil
+		}
+
+	case *ast.ListLiteral:
+		// The element type is taken from the first typed element, and all
+		// other elements are expected to match it.
+		elems := make([]any, 0, len(e.Elements))
+		var elemType value.Type
+		for _, el := range e.Elements {
+			x := a.checkExpr(c, el)
+			if t, ok := x.(value.Type); ok && elemType == nil {
+				elemType = t
+			}
+			elems = append(elems, x)
+		}
+		if elemType == nil {
+			return value.ListType{}
+		}
+		for i, x := range elems {
+			a.expectType(x, Usage{
+				Type: elemType,
+				Kind: UsageKindList,
+				Pos:  e.Elements[i].Start(),
+				End:  e.Elements[i].End(),
+				Path: c.path,
+			})
+		}
+		return value.ListType{Elem: elemType}
+
 	case *ast.CallExpr:
-		return a.checkFunc(c, e.Function, e.Arguments)
+		return a.checkFunc(c, e.Function, e.Arguments, false)
 
 	case *ast.PipeExpr:
-		return a.checkFunc(c, e.Function, []ast.Expr{e.Argument})
+		return a.checkFunc(c, e.Function, append([]ast.Expr{e.Argument}, e.Arguments...), true)
+
+	case *ast.ConditionalExpr:
+		if condition := a.checkExpr(c, e.Condition); condition != nil {
+			a.expectType(condition, Usage{
+				Type: value.TypeBool,
+				Kind: UsageKindIf,
+				Pos:  e.Condition.Start(),
+				End:  e.Condition.End(),
+				Path: c.path,
+			})
+		}
+		x := a.checkExpr(c, e.Consequence)
+		y := a.checkExpr(c, e.Alternative)
+		if x == nil || y == nil {
+			return nil
+		}
+		// Both operands must have the same type, which is the type of the
+		// expression.
+		switch xx := x.(type) {
+		case value.Type:
+			switch yy := y.(type) {
+			case value.Type:
+				if !value.Compatible(yy, xx) {
+					a.addDiagnostic(InvalidOperation{
+						X:     xx,
+						Y:     yy,
+						Pos_:  e.Start(),
+						End_:  e.End(),
+						Path_: c.path,
+					})
+				}
+			case TypeVar:
+				a.expectType(yy, Usage{
+					Type: xx,
+					Kind: UsageKindConditional,
+					Pos:  e.Alternative.Start(),
+					End:  e.Alternative.End(),
+					Path: c.path,
+				})
+			}
+			return xx
+		case TypeVar:
+			switch yy := y.(type) {
+			case value.Type:
+				a.expectType(xx, Usage{
+					Type: yy,
+					Kind: UsageKindConditional,
+					Pos:  e.Consequence.Start(),
+					End:  e.Consequence.End(),
+					Path: c.path,
+				})
+				return yy
+			case TypeVar:
+				a.addDiagnostic(CrossVarTyping{
+					X:     xx,
+					Y:     yy,
+					Pos_:  e.Start(),
+					End_:  e.End(),
+					Path_: c.path,
+				})
+			}
+		}
+		return nil
 
 	default:
 		panic(fmt.Sprintf("analyzer: unexpected expr type %T", expr))
 	}
 }
 
-// checkFunc verifies a function call against the builtin function registry. It
-// ensures argument count and types match the builtin definition, producing
-// diagnostics on mismatch. Returns the function’s declared return type if
-// found, or nil on failure.
-func (a *Analyzer) checkFunc(c internalContext, ident ast.Identifier, exprs []ast.Expr) any {
+// checkFunc verifies a call of a macro or a builtin function. It ensures
+// argument count and types match the definition, producing diagnostics on
+// mismatch. Returns the function’s return type if found, or nil on failure.
+// piped is set if the first argument is the value piped to the function.
+func (a *Analyzer) checkFunc(c internalContext, ident ast.Identifier, exprs []ast.Expr, piped bool) any {
+	if m, ok := c.macros[ident.Value]; ok {
+		a.checkMacro(m)
+		return a.checkCall(c, ident, exprs, piped, m.params, value.TypeString)
+	}
 	fn, err := builtin.LookupFunction(ident)
 	if err != nil {
 		a.addDiagnostic(BuiltinNotFound{
 			Name:  ident.Value,
 			Msg:   err.Error(),
 			Pos_:  ident.Start(),
+			End_:  ident.End(),
 			Path_: c.path,
 		})
 		return nil
 	}
-	// TODO(skewb1k): improve error messages for PipeExpr.
-	if len(exprs) != len(fn.ArgTypes) {
+	return a.checkCall(c, ident, exprs, piped, fn.ArgTypes, fn.ReturnType)
+}
+
+// checkCall checks the arguments exprs of a call of the function ident
+// against argTypes. A nil argument type accepts any argument.
+func (a *Analyzer) checkCall(
+	c internalContext,
+	ident ast.Identifier,
+	exprs []ast.Expr,
+	piped bool,
+	argTypes []value.Type,
+	returnType value.Type,
+) any {
+	if len(exprs) != len(argTypes) {
+		// Extra arguments are reported at their span, missing arguments at
+		// the function.
+		pos, end := ident.Start(), ident.End()
+		if len(exprs) > len(argTypes) {
+			pos, end = exprs[len(argTypes)].Start(), exprs[len(exprs)-1].End()
+		}
 		a.addDiagnostic(IncorrectArgCount{
 			FuncName: ident.Value,
 			Got:      len(exprs),
-			Want:     len(fn.ArgTypes),
-			// TODO(skewb1k): use proper arg pos.
-			Pos_:  ident.Start(),
-			Path_: c.path,
+			Want:     len(argTypes),
+			Piped:    piped,
+			Pos_:     pos,
+			End_:     end,
+			Path_:    c.path,
 		})
-		return fn.ReturnType
+		return returnType
 	}
 
 	// Evaluate and collect argument types for the function call. If any
@@ -279,14 +773,18 @@ func (a *Analyzer) checkFunc(c internalContext, ident ast.Identifier, exprs []as
 	}
 
 	for i, arg := range args {
+		if argTypes[i] == nil {
+			continue
+		}
 		a.expectType(arg.typ, Usage{
-			Type: fn.ArgTypes[i],
+			Type: argTypes[i],
 			Kind: UsageKindCall,
 			Pos:  arg.expr.Start(),
+			End:  arg.expr.End(),
 			Path: c.path,
 		})
 	}
-	return fn.ReturnType
+	return returnType
 }
 
 // expectType validates that a given expression type matches the expected usage
@@ -296,19 +794,131 @@ func (a *Analyzer) checkFunc(c internalContext, ident ast.Identifier, exprs []as
 func (a *Analyzer) expectType(t any, u Usage) {
 	switch xx := t.(type) {
 	case value.Type:
-		if xx != u.Type {
+		if !value.Compatible(xx, u.Type) {
 			a.addDiagnostic(WrongUsage{
 				WantType: u.Type,
 				GotType:  xx,
 				Pos_:     u.Pos,
+				End_:     u.End,
 				Path_:    u.Path,
 			})
 		}
 	case TypeVar:
-		a.addUsage(xx.String(), u)
+		// Usages only record the outer type of a list or map; the types of
+		// its elements and fields are inferred separately from their own
+		// usages.
+		switch want := u.Type.(type) {
+		case value.ListType:
+			elemUsage := u
+			u.Type = value.ListType{}
+			a.addUsage(xx.String(), u)
+			if want.Elem != nil {
+				elemUsage.Type = want.Elem
+				a.expectType(xx.elem(), elemUsage)
+			}
+		case value.MapType:
+			fieldUsage := u
+			u.Type = value.MapType{}
+			a.addUsage(xx.String(), u)
+			if want.Fields != nil {
+				for name, t := range *want.Fields {
+					fieldUsage.Type = t
+					a.expectType(xx.field(name), fieldUsage)
+				}
+			}
+		default:
+			a.addUsage(xx.String(), u)
+		}
+	}
+}
+
+// checkIn checks the operands x and y of the in operator e. The right
+// operand is a string searched for the substring x or a list searched for
+// the element x. If it is a variable, its type is only inferred when x
+// cannot be a substring; otherwise it is recorded as a string or a list.
+func (a *Analyzer) checkIn(c internalContext, e *ast.BinaryExpr, x, y any) {
+	switch yy := y.(type) {
+	case value.Type:
+		var elem value.Type
+		switch t := yy.(type) {
+		case value.ListType:
+			elem = t.Elem
+		default:
+			if t != value.TypeString {
+				a.addDiagnostic(UndefinedOperator{
+					Operator: e.Operator,
+					Type:     t,
+					Pos_:     e.ROperand.Start(),
+					End_:     e.ROperand.End(),
+					Path_:    c.path,
+				})
+				return
+			}
+			elem = value.TypeString
+		}
+		if elem != nil {
+			a.expectType(x, Usage{
+				Type: elem,
+				Kind: UsageKindBinOp,
+				Pos:  e.LOperand.Start(),
+				End:  e.LOperand.End(),
+				Path: c.path,
+			})
+		} else {
+			a.expectElement(c, e, x)
+		}
+	case TypeVar:
+		if xx, ok := x.(value.Type); ok && xx != value.TypeString {
+			a.expectType(yy, Usage{
+				Type: value.ListType{Elem: xx},
+				Kind: UsageKindBinOp,
+				Pos:  e.ROperand.Start(),
+				End:  e.ROperand.End(),
+				Path: c.path,
+			})
+			return
+		}
+		a.addUsage(yy.String(), Usage{
+			Type: value.TypeString,
+			Kind: UsageKindIn,
+			Pos:  e.ROperand.Start(),
+			End:  e.ROperand.End(),
+			Path: c.path,
+		})
+		a.expectElement(c, e, x)
+	}
+}
+
+// expectElement records the usage of the left operand x of the in
+// operator e when the right operand does not constrain its type.
+func (a *Analyzer) expectElement(c internalContext, e *ast.BinaryExpr, x any) {
+	if xx, ok := x.(TypeVar); ok {
+		a.addUsage(xx.String(), Usage{
+			Type: value.TypeString,
+			Kind: UsageKindInElement,
+			Pos:  e.LOperand.Start(),
+			End:  e.LOperand.End(),
+			Path: c.path,
+		})
 	}
 }
 
+// isOrdering reports whether op compares the order of its operands.
+func isOrdering(op token.Kind) bool {
+	switch op {
+	case token.LESS, token.LESS_EQUAL, token.GREATER, token.GREATER_EQUAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// displayable reports whether values of type t can be rendered by a display
+// block.
+func displayable(t value.Type) bool {
+	return t == value.TypeString || t == value.TypeInt
+}
+
 func (a *Analyzer) addUsage(varName string, u Usage) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
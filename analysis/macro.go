@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/value"
+)
+
+// macro is a macro definition found in the file path. The types of its
+// parameters are inferred from their usages in the body, like the types of
+// template variables, and are known once the macro is checked.
+type macro struct {
+	block *ast.MacroBlock
+	path  string
+	// scope holds the macros available to the body.
+	scope   map[string]*macro
+	checked bool
+	// params holds the types of the parameters. A nil type means the
+	// parameter is not used in a way that constrains its type.
+	params []value.Type
+}
+
+// collectMacros adds the macros defined or imported by t, found in the file
+// c.path, to macros, keeping the existing ones.
+func (a *Analyzer) collectMacros(c internalContext, t *ast.Template, macros map[string]*macro) {
+	var importBlocks []*ast.ImportBlock
+	ast.Inspect(t, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Template:
+			return true
+		case *ast.MacroBlock:
+			if _, ok := macros[n.Name.Value]; !ok {
+				macros[n.Name.Value] = a.macro(n, c.path)
+			}
+		case *ast.ImportBlock:
+			importBlocks = append(importBlocks, n)
+		}
+		// Macros and imports are at the top level of templates.
+		return false
+	})
+
+	if a.Include == nil {
+		return
+	}
+	for _, block := range importBlocks {
+		name := string(value.FromBasicLit(&block.Path).(value.String))
+		if slices.Contains(c.includes, name) {
+			a.addDiagnostic(IncludeError{
+				Msg:   fmt.Sprintf("import cycle: %s -> %s", strings.Join(c.includes, " -> "), name),
+				Pos_:  block.Path.Start(),
+				End_:  block.Path.End(),
+				Path_: c.path,
+			})
+			continue
+		}
+		imported, err := a.Include(name)
+		if err != nil {
+			a.addDiagnostic(IncludeError{
+				Msg:   err.Error(),
+				Pos_:  block.Path.Start(),
+				End_:  block.Path.End(),
+				Path_: c.path,
+			})
+			continue
+		}
+		ic := c
+		ic.path = name
+		ic.includes = append(slices.Clip(c.includes), name)
+		a.collectMacros(ic, imported, macros)
+	}
+}
+
+// macro returns the macro defined by block in the file path. Every
+// definition is checked only once, even if it is imported by several
+// templates.
+func (a *Analyzer) macro(block *ast.MacroBlock, path string) *macro {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m, ok := a.macros[block]
+	if !ok {
+		m = &macro{block: block, path: path}
+		a.macros[block] = m
+	}
+	return m
+}
+
+// defineMacros adds the macros of the enclosing template c to macros,
+// keeping the existing ones, and checks their bodies.
+func (a *Analyzer) defineMacros(c internalContext, macros map[string]*macro) map[string]*macro {
+	for name, m := range c.macros {
+		if _, ok := macros[name]; !ok {
+			macros[name] = m
+		}
+	}
+	for _, m := range macros {
+		if m.scope == nil {
+			m.scope = macros
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(macros)) {
+		a.checkMacro(macros[name])
+	}
+	return macros
+}
+
+// checkMacro checks the body of m once and infers the types of its
+// parameters.
+func (a *Analyzer) checkMacro(m *macro) {
+	if m.checked {
+		return
+	}
+	m.checked = true
+
+	c := internalContext{
+		path:   m.path,
+		macros: m.scope,
+	}
+	name := m.block.Name.Value
+	for _, param := range m.block.Parameters {
+		c = c.withLocal(param.Value, paramVar(name, param.Value))
+	}
+	a.checkBlocks(c, m.block.Body)
+
+	m.params = make([]value.Type, len(m.block.Parameters))
+	for i, param := range m.block.Parameters {
+		m.params[i] = a.inferredType(paramVar(name, param.Value))
+	}
+}
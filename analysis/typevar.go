@@ -2,6 +2,7 @@ package analysis
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/vietmpl/vie/value"
 )
@@ -15,25 +16,81 @@ func (tv TypeVar) String() string {
 	return string(tv)
 }
 
+// elemSuffix marks the type variable of the elements of a list, and
+// fieldSeparator separates a map from its field. Parameters of macros are
+// written as macro(param).
+const (
+	elemSuffix     = "[]"
+	fieldSeparator = "."
+	paramOpen      = "("
+	paramClose     = ")"
+)
+
+// paramVar returns the type variable of the parameter param of the macro
+// named macro.
+func paramVar(macro, param string) TypeVar {
+	return TypeVar(macro + paramOpen + param + paramClose)
+}
+
+// elem returns the type variable of the elements of the list tv.
+func (tv TypeVar) elem() TypeVar {
+	return tv + elemSuffix
+}
+
+// field returns the type variable of the field name of the map tv.
+func (tv TypeVar) field(name string) TypeVar {
+	return tv + fieldSeparator + TypeVar(name)
+}
+
+// isRoot reports whether tv names a template variable rather than a part of
+// one or a parameter of a macro.
+func (tv TypeVar) isRoot() bool {
+	return !strings.ContainsAny(string(tv), elemSuffix+fieldSeparator+paramOpen)
+}
+
+// fieldName returns the name of the field tv and the type variable of the
+// map it belongs to. ok is false if tv is not a field.
+func (tv TypeVar) fieldName() (parent TypeVar, name string, ok bool) {
+	if strings.HasSuffix(string(tv), elemSuffix) {
+		return "", "", false
+	}
+	i := strings.LastIndex(string(tv), fieldSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	return tv[:i], string(tv[i+len(fieldSeparator):]), true
+}
+
 func MergeTypes(typemap map[string]value.Type, data map[string]value.Value) []error {
 	var errors []error
 	for varname, typ := range typemap {
 		val, ok := data[varname]
 		if ok {
-			if val.Type() != typ {
+			if !value.HasType(val, typ) {
 				errors = append(errors, fmt.Errorf("%s: expected %s, got %s\n",
 					varname, typ, val.Type()))
 			}
 		} else {
 			// Assign a default value for missing variables.
 			// TODO(skewb1k): maybe the parser should handle undefined variables.
-			switch typ {
-			case value.TypeBool:
-				data[varname] = value.Bool(false)
-			case value.TypeString:
-				data[varname] = value.String("")
+			switch typ := typ.(type) {
+			case value.BasicType:
+				switch typ {
+				case value.TypeBool:
+					data[varname] = value.Bool(false)
+				case value.TypeString:
+					data[varname] = value.String("")
+				case value.TypeInt:
+					data[varname] = value.Int(0)
+				default:
+					panic(fmt.Sprintf("unexpected Type value: %d", typ))
+				}
+			case value.ListType:
+				data[varname] = value.List{}
+			case value.MapType:
+				data[varname] = value.Map{}
 			default:
-				panic(fmt.Sprintf("unexpected Type value: %d", typ))
+				panic(fmt.Sprintf("unexpected Type value: %v", typ))
 			}
 		}
 	}
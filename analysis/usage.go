@@ -13,11 +13,23 @@ const (
 	UsageKindBinOp
 	UsageKindUnOp
 	UsageKindCall
+	UsageKindFor
+	UsageKindList
+	UsageKindMember
+	UsageKindConditional
+	UsageKindSwitch
+	// UsageKindIn is the usage of the right operand of the in operator,
+	// which accepts strings and lists.
+	UsageKindIn
+	// UsageKindInElement is the usage of the left operand of the in
+	// operator searched in a variable, which accepts any type.
+	UsageKindInElement
 )
 
 type Usage struct {
 	Type value.Type
 	Kind usageKind
 	Pos  ast.Location
+	End  ast.Location
 	Path string
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+)
+
+func newCmdAST() *cobra.Command {
+	var delimiters parse.Delimiters
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "ast PATH",
+		Short: "Print the syntax tree of a template",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := args[0]
+
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			parseOptions, err := fileParseOptions(path, delimiters)
+			if err != nil {
+				return err
+			}
+			f, err := parseOptions.File(path, src)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				out, err := json.MarshalIndent(f, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s\n", out)
+				return nil
+			}
+			printTree(f)
+			return nil
+		},
+	}
+
+	addDelimitersFlag(cmd, &delimiters)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the tree as JSON, with zero-based positions")
+
+	return cmd
+}
+
+// printTree prints the nodes of template one per line, indented under their
+// parent, as the type of the node, its 1-based span and its value if any.
+func printTree(template *ast.Template) {
+	depth := 0
+	ast.Inspect(template, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		line := fmt.Sprintf("%s%s %s-%s",
+			strings.Repeat("  ", depth), strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."), n.Start(), n.End())
+		switch n := n.(type) {
+		case *ast.TextBlock:
+			line += fmt.Sprintf(" %q", n.Content)
+		case *ast.CommentBlock:
+			line += fmt.Sprintf(" %q", n.Content)
+		case *ast.RawBlock:
+			line += fmt.Sprintf(" %q", n.Content)
+		case *ast.Identifier:
+			line += " " + n.Value
+		case *ast.BasicLiteral:
+			line += " " + n.Value
+		case *ast.UnaryExpr:
+			line += " " + n.Operator.String()
+		case *ast.BinaryExpr:
+			line += " " + n.Operator.String()
+		}
+		fmt.Println(line)
+		depth++
+		return true
+	})
+}
@@ -1,16 +1,87 @@
 package ast
 
 import (
+	"fmt"
+
 	"github.com/vietmpl/vie/token"
 )
 
+// Location is a position in the source of a template. Line and Column are
+// zero-based, and Column and Offset are measured in bytes.
 type Location struct {
-	Line   uint
-	Column uint
+	Line   uint `json:"line"`
+	Column uint `json:"column"`
+	Offset uint `json:"offset"`
+}
+
+// String returns the 1-based line and column of l as "line:column".
+func (l Location) String() string {
+	return fmt.Sprintf("%d:%d", l.Line+1, l.Column+1)
+}
+
+// after returns the location following a single byte at l, which must not
+// be a line break.
+func (l Location) after() Location {
+	return Location{Line: l.Line, Column: l.Column + 1, Offset: l.Offset + 1}
+}
+
+// Span is the range of source covered by a block, from the start of its
+// first tag to the end of its last one.
+type Span struct {
+	Start_ Location `json:"start"`
+	End_   Location `json:"end"`
 }
 
+func (s *Span) Start() Location { return s.Start_ }
+func (s *Span) End() Location   { return s.End_ }
+
 type Template struct {
-	Blocks []Block
+	Blocks []Block `json:"blocks"`
+}
+
+// Start returns the start of the first block of t.
+func (t *Template) Start() Location {
+	if len(t.Blocks) == 0 {
+		return Location{}
+	}
+	return t.Blocks[0].Start()
+}
+
+// End returns the end of the last block of t.
+func (t *Template) End() Location {
+	if len(t.Blocks) == 0 {
+		return Location{}
+	}
+	return t.Blocks[len(t.Blocks)-1].End()
+}
+
+// Extends returns the extends block of t, or nil if t does not extend
+// another template.
+func (t *Template) Extends() *ExtendsBlock {
+	for _, b := range t.Blocks {
+		if extends, ok := b.(*ExtendsBlock); ok {
+			return extends
+		}
+	}
+	return nil
+}
+
+// NamedBlocks returns the named blocks found in blocks, including nested
+// ones, by name. Blocks defined in macros are not included.
+func NamedBlocks(blocks []Block) map[string]*NamedBlock {
+	named := make(map[string]*NamedBlock)
+	for _, b := range blocks {
+		Inspect(b, func(n Node) bool {
+			switch n := n.(type) {
+			case *NamedBlock:
+				named[n.Name.Value] = n
+			case *MacroBlock, Expr:
+				return false
+			}
+			return true
+		})
+	}
+	return named
 }
 
 // Interfaces ------------------------------------
@@ -18,7 +89,10 @@ type Template struct {
 // Node is the base interface implemented by all AST nodes.
 type Node interface {
 	node()
-	// TODO(skewb1k): add Start().
+	// Start returns the location of the first byte of the node.
+	Start() Location
+	// End returns the location immediately after the node.
+	End() Location
 }
 
 type Block interface {
@@ -28,40 +102,164 @@ type Block interface {
 
 type Expr interface {
 	Node
-	Start() Location
 	exprNode()
-	// TODO(skewb1k): add End().
 }
 
 // Blocks ----------------------------------------
 
+// Trim records the whitespace control markers of a tag. Left is set for
+// `{%-`, `{{-` and `{#-`, and Right for `-%}`, `-}}` and `-#}`.
+type Trim struct {
+	Left  bool `json:"left"`
+	Right bool `json:"right"`
+}
+
 type (
 	TextBlock struct {
-		Content string
+		Span
+		Content string `json:"content"`
 	}
 
 	CommentBlock struct {
-		Content string
+		Span
+		Content string `json:"content"`
+		Trim    Trim   `json:"trim"`
+	}
+
+	// RawBlock holds text between {% raw %} and {% end %} that is output as
+	// is, without interpreting tags or removing whitespace.
+	RawBlock struct {
+		Span
+		Content string `json:"content"`
+		Trim    Trim   `json:"trim"`
+		EndTrim Trim   `json:"endTrim"`
 	}
 
 	DisplayBlock struct {
-		Value Expr
+		Span
+		Value Expr `json:"value"`
+		Trim  Trim `json:"trim"`
 	}
 
 	IfBlock struct {
-		Branches    []IfBranch
-		Alternative *[]Block
+		Span
+		Branches    []IfBranch `json:"branches"`
+		Alternative *[]Block   `json:"alternative"`
+		ElseTrim    Trim       `json:"elseTrim"`
+		EndTrim     Trim       `json:"endTrim"`
+	}
+
+	// SwitchBlock renders the body of the first case with a value equal to
+	// Value, or Default if no case matches. Space holds the whitespace
+	// between the switch tag and the first case, which is not rendered.
+	SwitchBlock struct {
+		Span
+		Value       Expr         `json:"value"`
+		Space       string       `json:"space"`
+		Cases       []SwitchCase `json:"cases"`
+		Default     *[]Block     `json:"default"`
+		Trim        Trim         `json:"trim"`
+		DefaultTrim Trim         `json:"defaultTrim"`
+		EndTrim     Trim         `json:"endTrim"`
+	}
+
+	// ForBlock renders Body once for each element of Iterable, binding the
+	// element to Variable. Alternative is rendered when Iterable is empty.
+	ForBlock struct {
+		Span
+		Variable    Identifier `json:"variable"`
+		Iterable    Expr       `json:"iterable"`
+		Body        []Block    `json:"body"`
+		Alternative *[]Block   `json:"alternative"`
+		Trim        Trim       `json:"trim"`
+		ElseTrim    Trim       `json:"elseTrim"`
+		EndTrim     Trim       `json:"endTrim"`
+	}
+
+	// IncludeBlock renders the template named by the string literal Path in
+	// place of the block.
+	IncludeBlock struct {
+		Span
+		Path BasicLiteral `json:"path"`
+		Trim Trim         `json:"trim"`
+	}
+
+	// ExtendsBlock makes the template a child of the template named by the
+	// string literal Path. A child renders as its base template, with the
+	// named blocks of the child replacing those of the base. Base is nil
+	// until the base template is resolved.
+	ExtendsBlock struct {
+		Span
+		Path BasicLiteral `json:"path"`
+		Trim Trim         `json:"trim"`
+		Base *Template    `json:"-"`
+	}
+
+	// NamedBlock is a region of a template that can be overridden by a
+	// template extending it.
+	NamedBlock struct {
+		Span
+		Name    Identifier `json:"name"`
+		Body    []Block    `json:"body"`
+		Trim    Trim       `json:"trim"`
+		EndTrim Trim       `json:"endTrim"`
+	}
+
+	// MacroBlock defines a function that returns Body rendered with its
+	// Parameters bound to the arguments of a call. It renders nothing in
+	// place of the block.
+	MacroBlock struct {
+		Span
+		Name       Identifier   `json:"name"`
+		Parameters []Identifier `json:"parameters"`
+		Body       []Block      `json:"body"`
+		Trim       Trim         `json:"trim"`
+		EndTrim    Trim         `json:"endTrim"`
+	}
+
+	// SetBlock binds Name to the value of Value for the blocks following it
+	// in the same body.
+	SetBlock struct {
+		Span
+		Name  Identifier `json:"name"`
+		Value Expr       `json:"value"`
+		Trim  Trim       `json:"trim"`
+	}
+
+	// ImportBlock makes the macros defined in the template named by the
+	// string literal Path available to the template.
+	ImportBlock struct {
+		Span
+		Path BasicLiteral `json:"path"`
+		Trim Trim         `json:"trim"`
 	}
 )
 
 func (*TextBlock) blockNode()    {}
 func (*CommentBlock) blockNode() {}
+func (*RawBlock) blockNode()     {}
 func (*DisplayBlock) blockNode() {}
 func (*IfBlock) blockNode()      {}
+func (*SwitchBlock) blockNode()  {}
+func (*ForBlock) blockNode()     {}
+func (*IncludeBlock) blockNode() {}
+func (*ExtendsBlock) blockNode() {}
+func (*NamedBlock) blockNode()   {}
+func (*MacroBlock) blockNode()   {}
+func (*ImportBlock) blockNode()  {}
+func (*SetBlock) blockNode()     {}
 
 type IfBranch struct {
-	Condition   Expr
-	Consequence []Block
+	Condition   Expr    `json:"condition"`
+	Consequence []Block `json:"consequence"`
+	Trim        Trim    `json:"trim"`
+}
+
+// SwitchCase is a case of a [SwitchBlock], matching any of Values.
+type SwitchCase struct {
+	Values []Expr  `json:"values"`
+	Body   []Block `json:"body"`
+	Trim   Trim    `json:"trim"`
 }
 
 // Expressions -----------------------------------
@@ -71,72 +269,139 @@ type BasicLitKind uint8
 const (
 	KindBool BasicLitKind = iota
 	KindString
+	KindInt
 )
 
 type (
 	BasicLiteral struct {
-		Start_ Location
-		Kind   BasicLitKind
-		Value  string
+		Start_ Location     `json:"start"`
+		End_   Location     `json:"end"`
+		Kind   BasicLitKind `json:"kind"`
+		Value  string       `json:"value"`
 	}
 
 	Identifier struct {
-		Start_ Location
-		Value  string
+		Start_ Location `json:"start"`
+		End_   Location `json:"end"`
+		Value  string   `json:"value"`
 	}
 
 	UnaryExpr struct {
-		OperatorLocation Location
-		Operator         token.Kind
-		Operand          Expr
+		OperatorLocation Location   `json:"operatorLocation"`
+		Operator         token.Kind `json:"operator"`
+		Operand          Expr       `json:"operand"`
 	}
 
 	BinaryExpr struct {
-		LOperand Expr
-		Operator token.Kind
-		ROperand Expr
+		LOperand Expr       `json:"lOperand"`
+		Operator token.Kind `json:"operator"`
+		ROperand Expr       `json:"rOperand"`
 	}
 
 	ParenExpr struct {
-		LparenLocation Location
-		Value          Expr
+		LparenLocation Location `json:"lparenLocation"`
+		Value          Expr     `json:"value"`
+		RparenLocation Location `json:"rparenLocation"`
+	}
+
+	ListLiteral struct {
+		LbrackLocation Location `json:"lbrackLocation"`
+		Elements       []Expr   `json:"elements"`
+		RbrackLocation Location `json:"rbrackLocation"`
+	}
+
+	// MemberExpr accesses the field Member of the map Object.
+	MemberExpr struct {
+		Object Expr       `json:"object"`
+		Member Identifier `json:"member"`
 	}
 
 	CallExpr struct {
-		Function  Identifier
-		Arguments []Expr
+		Function       Identifier `json:"function"`
+		Arguments      []Expr     `json:"arguments"`
+		RparenLocation Location   `json:"rparenLocation"`
 	}
 
+	// PipeExpr calls Function with Argument followed by Arguments.
+	// RparenLocation is the zero Location if Function is not followed by an
+	// argument list.
 	PipeExpr struct {
-		Argument Expr
-		Function Identifier
+		Argument       Expr       `json:"argument"`
+		Function       Identifier `json:"function"`
+		Arguments      []Expr     `json:"arguments"`
+		RparenLocation Location   `json:"rparenLocation"`
+	}
+
+	// ConditionalExpr evaluates to Consequence if Condition is true and to
+	// Alternative otherwise, written as `Condition ? Consequence :
+	// Alternative`.
+	ConditionalExpr struct {
+		Condition   Expr `json:"condition"`
+		Consequence Expr `json:"consequence"`
+		Alternative Expr `json:"alternative"`
 	}
 )
 
-func (*BasicLiteral) exprNode() {}
-func (*Identifier) exprNode()   {}
-func (*UnaryExpr) exprNode()    {}
-func (*BinaryExpr) exprNode()   {}
-func (*ParenExpr) exprNode()    {}
-func (*CallExpr) exprNode()     {}
-func (*PipeExpr) exprNode()     {}
-
-func (x *BasicLiteral) Start() Location { return x.Start_ }
-func (x *Identifier) Start() Location   { return x.Start_ }
-func (x *UnaryExpr) Start() Location    { return x.OperatorLocation }
-func (x *BinaryExpr) Start() Location   { return x.LOperand.Start() }
-func (x *ParenExpr) Start() Location    { return x.LparenLocation }
-func (x *CallExpr) Start() Location     { return x.Function.Start() }
-func (x *PipeExpr) Start() Location     { return x.Argument.Start() }
-
-func (*TextBlock) node()    {}
-func (*CommentBlock) node() {}
-func (*DisplayBlock) node() {}
-func (*IfBlock) node()      {}
-func (*BasicLiteral) node() {}
-func (*Identifier) node()   {}
-func (*UnaryExpr) node()    {}
-func (*BinaryExpr) node()   {}
-func (*ParenExpr) node()    {}
-func (*CallExpr) node()     {}
-func (*PipeExpr) node()     {}
+func (*BasicLiteral) exprNode()    {}
+func (*Identifier) exprNode()      {}
+func (*UnaryExpr) exprNode()       {}
+func (*BinaryExpr) exprNode()      {}
+func (*ParenExpr) exprNode()       {}
+func (*ListLiteral) exprNode()     {}
+func (*MemberExpr) exprNode()      {}
+func (*CallExpr) exprNode()        {}
+func (*PipeExpr) exprNode()        {}
+func (*ConditionalExpr) exprNode() {}
+
+func (x *BasicLiteral) Start() Location    { return x.Start_ }
+func (x *Identifier) Start() Location      { return x.Start_ }
+func (x *UnaryExpr) Start() Location       { return x.OperatorLocation }
+func (x *BinaryExpr) Start() Location      { return x.LOperand.Start() }
+func (x *ParenExpr) Start() Location       { return x.LparenLocation }
+func (x *ListLiteral) Start() Location     { return x.LbrackLocation }
+func (x *MemberExpr) Start() Location      { return x.Object.Start() }
+func (x *CallExpr) Start() Location        { return x.Function.Start() }
+func (x *PipeExpr) Start() Location        { return x.Argument.Start() }
+func (x *ConditionalExpr) Start() Location { return x.Condition.Start() }
+
+func (x *BasicLiteral) End() Location    { return x.End_ }
+func (x *Identifier) End() Location      { return x.End_ }
+func (x *UnaryExpr) End() Location       { return x.Operand.End() }
+func (x *BinaryExpr) End() Location      { return x.ROperand.End() }
+func (x *ParenExpr) End() Location       { return x.RparenLocation.after() }
+func (x *ListLiteral) End() Location     { return x.RbrackLocation.after() }
+func (x *MemberExpr) End() Location      { return x.Member.End() }
+func (x *CallExpr) End() Location        { return x.RparenLocation.after() }
+func (x *ConditionalExpr) End() Location { return x.Alternative.End() }
+
+func (x *PipeExpr) End() Location {
+	if x.RparenLocation == (Location{}) {
+		return x.Function.End()
+	}
+	return x.RparenLocation.after()
+}
+
+func (*Template) node()        {}
+func (*TextBlock) node()       {}
+func (*CommentBlock) node()    {}
+func (*RawBlock) node()        {}
+func (*DisplayBlock) node()    {}
+func (*IfBlock) node()         {}
+func (*SwitchBlock) node()     {}
+func (*ForBlock) node()        {}
+func (*IncludeBlock) node()    {}
+func (*ExtendsBlock) node()    {}
+func (*NamedBlock) node()      {}
+func (*MacroBlock) node()      {}
+func (*ImportBlock) node()     {}
+func (*SetBlock) node()        {}
+func (*BasicLiteral) node()    {}
+func (*Identifier) node()      {}
+func (*UnaryExpr) node()       {}
+func (*BinaryExpr) node()      {}
+func (*ParenExpr) node()       {}
+func (*ListLiteral) node()     {}
+func (*MemberExpr) node()      {}
+func (*CallExpr) node()        {}
+func (*PipeExpr) node()        {}
+func (*ConditionalExpr) node() {}
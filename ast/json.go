@@ -0,0 +1,268 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Nodes are encoded in JSON as objects holding the name of their Go type as
+// "type", followed by their fields under the names given by their json
+// struct tags. Locations are zero-based like [Location], operators are
+// written as in templates, and the base template of an [ExtendsBlock] is
+// not encoded.
+
+// MarshalText implements [encoding.TextMarshaler], encoding k as "bool",
+// "string" or "int".
+func (k BasicLitKind) MarshalText() ([]byte, error) {
+	if int(k) >= len(basicLitKinds) {
+		return nil, fmt.Errorf("unknown literal kind %d", k)
+	}
+	return []byte(basicLitKinds[k]), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (k *BasicLitKind) UnmarshalText(text []byte) error {
+	for kind, s := range basicLitKinds {
+		if s == string(text) {
+			*k = BasicLitKind(kind)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown literal kind %q", text)
+}
+
+var basicLitKinds = [...]string{
+	KindBool:   "bool",
+	KindString: "string",
+	KindInt:    "int",
+}
+
+// newNode maps the JSON types of nodes to functions allocating them.
+var newNode = map[string]func() Node{
+	"Template":        func() Node { return new(Template) },
+	"TextBlock":       func() Node { return new(TextBlock) },
+	"CommentBlock":    func() Node { return new(CommentBlock) },
+	"RawBlock":        func() Node { return new(RawBlock) },
+	"DisplayBlock":    func() Node { return new(DisplayBlock) },
+	"IfBlock":         func() Node { return new(IfBlock) },
+	"SwitchBlock":     func() Node { return new(SwitchBlock) },
+	"ForBlock":        func() Node { return new(ForBlock) },
+	"IncludeBlock":    func() Node { return new(IncludeBlock) },
+	"ExtendsBlock":    func() Node { return new(ExtendsBlock) },
+	"NamedBlock":      func() Node { return new(NamedBlock) },
+	"MacroBlock":      func() Node { return new(MacroBlock) },
+	"SetBlock":        func() Node { return new(SetBlock) },
+	"ImportBlock":     func() Node { return new(ImportBlock) },
+	"BasicLiteral":    func() Node { return new(BasicLiteral) },
+	"Identifier":      func() Node { return new(Identifier) },
+	"UnaryExpr":       func() Node { return new(UnaryExpr) },
+	"BinaryExpr":      func() Node { return new(BinaryExpr) },
+	"ParenExpr":       func() Node { return new(ParenExpr) },
+	"ListLiteral":     func() Node { return new(ListLiteral) },
+	"MemberExpr":      func() Node { return new(MemberExpr) },
+	"CallExpr":        func() Node { return new(CallExpr) },
+	"PipeExpr":        func() Node { return new(PipeExpr) },
+	"ConditionalExpr": func() Node { return new(ConditionalExpr) },
+}
+
+var nodeType = reflect.TypeFor[Node]()
+
+// marshalNode encodes the node n, a pointer to a struct.
+func marshalNode(n Node) ([]byte, error) {
+	v := reflect.ValueOf(n).Elem()
+	var b bytes.Buffer
+	b.WriteString(`{"type":`)
+	b.WriteString(strconv.Quote(v.Type().Name()))
+	if err := marshalFields(&b, v); err != nil {
+		return nil, err
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalFields writes the fields of the addressable struct v to b, each
+// preceded by a comma. The fields of embedded structs are written in place.
+func marshalFields(b *bytes.Buffer, v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			if err := marshalFields(b, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		name := field.Tag.Get("json")
+		if name == "-" {
+			continue
+		}
+		// Struct fields are passed by address for the methods of nodes
+		// such as identifiers to be used.
+		data, err := json.Marshal(v.Field(i).Addr().Interface())
+		if err != nil {
+			return err
+		}
+		b.WriteByte(',')
+		b.WriteString(strconv.Quote(name))
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	return nil
+}
+
+// unmarshalNode decodes data into the node n, a pointer to a struct. The
+// type of data must be the type of n.
+func unmarshalNode(data []byte, n Node) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(n).Elem()
+	var typ string
+	if err := json.Unmarshal(fields["type"], &typ); err != nil || typ != v.Type().Name() {
+		return fmt.Errorf("ast: cannot unmarshal node of type %s into %s", fields["type"], v.Type().Name())
+	}
+	return unmarshalFields(fields, v)
+}
+
+// unmarshalFields decodes the fields of the addressable struct v. Missing
+// fields keep their value.
+func unmarshalFields(fields map[string]json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			if err := unmarshalFields(fields, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		name := field.Tag.Get("json")
+		data, ok := fields[name]
+		if name == "-" || !ok {
+			continue
+		}
+		if err := unmarshalValue(data, v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), name, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalValue decodes data into the addressable value v. Blocks and
+// expressions stored in interfaces are allocated by their type.
+func unmarshalValue(data []byte, v reflect.Value) error {
+	t := v.Type()
+	if t.Kind() == reflect.Interface || t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		if string(data) == "null" {
+			v.SetZero()
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return err
+		}
+		newFunc, ok := newNode[header.Type]
+		if !ok {
+			return fmt.Errorf("unknown node type %q", header.Type)
+		}
+		n := newFunc()
+		if !reflect.TypeOf(n).Implements(t) {
+			return fmt.Errorf("cannot use %s as %s", header.Type, t.Name())
+		}
+		if err := unmarshalNode(data, n); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(n))
+		return nil
+
+	case reflect.Pointer:
+		v.Set(reflect.New(t.Elem()))
+		return unmarshalValue(data, v.Elem())
+
+	case reflect.Slice:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return err
+		}
+		v.Set(reflect.MakeSlice(t, len(elements), len(elements)))
+		for i, element := range elements {
+			if err := unmarshalValue(element, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Struct:
+		if reflect.PointerTo(t).Implements(nodeType) {
+			return unmarshalNode(data, v.Addr().Interface().(Node))
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return unmarshalFields(fields, v)
+
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+func (n *Template) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *TextBlock) MarshalJSON() ([]byte, error)       { return marshalNode(n) }
+func (n *CommentBlock) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+func (n *RawBlock) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *DisplayBlock) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+func (n *IfBlock) MarshalJSON() ([]byte, error)         { return marshalNode(n) }
+func (n *SwitchBlock) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *ForBlock) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *IncludeBlock) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+func (n *ExtendsBlock) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+func (n *NamedBlock) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *MacroBlock) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *SetBlock) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *ImportBlock) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *BasicLiteral) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+func (n *Identifier) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *UnaryExpr) MarshalJSON() ([]byte, error)       { return marshalNode(n) }
+func (n *BinaryExpr) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *ParenExpr) MarshalJSON() ([]byte, error)       { return marshalNode(n) }
+func (n *ListLiteral) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *MemberExpr) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *CallExpr) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *PipeExpr) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *ConditionalExpr) MarshalJSON() ([]byte, error) { return marshalNode(n) }
+
+func (n *Template) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *TextBlock) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, n) }
+func (n *CommentBlock) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
+func (n *RawBlock) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *DisplayBlock) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
+func (n *IfBlock) UnmarshalJSON(data []byte) error         { return unmarshalNode(data, n) }
+func (n *SwitchBlock) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *ForBlock) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *IncludeBlock) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
+func (n *ExtendsBlock) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
+func (n *NamedBlock) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *MacroBlock) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *SetBlock) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *ImportBlock) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *BasicLiteral) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
+func (n *Identifier) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *UnaryExpr) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, n) }
+func (n *BinaryExpr) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *ParenExpr) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, n) }
+func (n *ListLiteral) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *MemberExpr) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *CallExpr) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *PipeExpr) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *ConditionalExpr) UnmarshalJSON(data []byte) error { return unmarshalNode(data, n) }
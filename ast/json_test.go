@@ -0,0 +1,74 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+)
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	// The source covers every type of node.
+	source := `a{# c #}{% raw %}r{% end %}{{- x.y | f(1) -}}` +
+		`{% if a and !b %}1{% elseif c %}{% else %}{% end %}` +
+		`{% switch x %}{% case 1, "s" %}{% default %}{% end %}` +
+		`{% for i in [1, 2] %}{% else %}{% end %}{% include "p" %}` +
+		`{% block b %}{% end %}{% macro m(a, b) %}{% end %}` +
+		`{% set z = (true ? g() : x | h) %}{% import "m" %}`
+	template, err := parse.Source([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ast.Template
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, template) {
+		t.Errorf("the decoded template differs from the original one")
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	t.Parallel()
+
+	template, err := parse.Source([]byte(`{{ -n }}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(template.Blocks[0].(*ast.DisplayBlock).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"UnaryExpr","operatorLocation":{"line":0,"column":3,"offset":3},` +
+		`"operator":"-","operand":{"type":"Identifier",` +
+		`"start":{"line":0,"column":4,"offset":4},"end":{"line":0,"column":5,"offset":5},"value":"n"}}`
+	if string(data) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, data)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		`{"type":"TextBlock"}`,
+		`{"type":"Template","blocks":[{"type":"Unknown"}]}`,
+		`{"type":"Template","blocks":[{"type":"Identifier"}]}`,
+		`{"type":"Template","blocks":[{"type":"DisplayBlock","value":{"type":"UnaryExpr","operator":"?!"}}]}`,
+	}
+	for _, data := range tests {
+		var template ast.Template
+		if err := json.Unmarshal([]byte(data), &template); err == nil {
+			t.Errorf("expected error decoding %s, got no error", data)
+		}
+	}
+}
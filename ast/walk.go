@@ -0,0 +1,336 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by [Walk].
+// If the result visitor w is not nil, Walk visits each of the children of
+// node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, in the order
+// of the source: it starts by calling v.Visit(node), and then visits the
+// children of node with the visitor returned by it. The base template of an
+// [ExtendsBlock] is not part of the tree.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Template:
+		walkBlocks(v, n.Blocks)
+
+	case *TextBlock, *CommentBlock, *RawBlock:
+		// nothing to do
+
+	case *DisplayBlock:
+		walkExpr(v, n.Value)
+
+	case *IfBlock:
+		for _, branch := range n.Branches {
+			walkExpr(v, branch.Condition)
+			walkBlocks(v, branch.Consequence)
+		}
+		if n.Alternative != nil {
+			walkBlocks(v, *n.Alternative)
+		}
+
+	case *SwitchBlock:
+		walkExpr(v, n.Value)
+		for _, c := range n.Cases {
+			walkExprs(v, c.Values)
+			walkBlocks(v, c.Body)
+		}
+		if n.Default != nil {
+			walkBlocks(v, *n.Default)
+		}
+
+	case *ForBlock:
+		Walk(v, &n.Variable)
+		walkExpr(v, n.Iterable)
+		walkBlocks(v, n.Body)
+		if n.Alternative != nil {
+			walkBlocks(v, *n.Alternative)
+		}
+
+	case *IncludeBlock:
+		Walk(v, &n.Path)
+
+	case *ExtendsBlock:
+		Walk(v, &n.Path)
+
+	case *ImportBlock:
+		Walk(v, &n.Path)
+
+	case *NamedBlock:
+		Walk(v, &n.Name)
+		walkBlocks(v, n.Body)
+
+	case *MacroBlock:
+		Walk(v, &n.Name)
+		for i := range n.Parameters {
+			Walk(v, &n.Parameters[i])
+		}
+		walkBlocks(v, n.Body)
+
+	case *SetBlock:
+		Walk(v, &n.Name)
+		walkExpr(v, n.Value)
+
+	case *BasicLiteral, *Identifier:
+		// nothing to do
+
+	case *UnaryExpr:
+		walkExpr(v, n.Operand)
+
+	case *BinaryExpr:
+		walkExpr(v, n.LOperand)
+		walkExpr(v, n.ROperand)
+
+	case *ParenExpr:
+		walkExpr(v, n.Value)
+
+	case *ListLiteral:
+		walkExprs(v, n.Elements)
+
+	case *MemberExpr:
+		walkExpr(v, n.Object)
+		Walk(v, &n.Member)
+
+	case *CallExpr:
+		Walk(v, &n.Function)
+		walkExprs(v, n.Arguments)
+
+	case *PipeExpr:
+		walkExpr(v, n.Argument)
+		Walk(v, &n.Function)
+		walkExprs(v, n.Arguments)
+
+	case *ConditionalExpr:
+		walkExpr(v, n.Condition)
+		walkExpr(v, n.Consequence)
+		walkExpr(v, n.Alternative)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkBlocks(v Visitor, blocks []Block) {
+	for _, b := range blocks {
+		Walk(v, b)
+	}
+}
+
+// walkExpr walks x, which is nil in incomplete expressions.
+func walkExpr(v Visitor, x Expr) {
+	if x != nil {
+		Walk(v, x)
+	}
+}
+
+func walkExprs(v Visitor, list []Expr) {
+	for _, x := range list {
+		walkExpr(v, x)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order: it starts
+// by calling f(node); node must not be nil. If f returns true, Inspect
+// invokes f recursively for each of the children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite replaces the nodes of the tree rooted at node with the results of
+// f, and returns the result for node. f is applied to every node after its
+// children, in the order of [Walk], and returns its argument to keep the
+// node. The tree is modified in place.
+//
+// A block in a list of blocks, such as the body of an [IfBlock], is removed
+// if f returns nil. Rewrite panics if f returns a node that cannot replace
+// the original one, such as a block in place of an expression, or anything
+// other than an [*Identifier] in place of an identifier.
+func Rewrite(node Node, f func(Node) Node) Node {
+	r := rewriter{f: f}
+	return r.node(node)
+}
+
+type rewriter struct {
+	f func(Node) Node
+}
+
+func (r *rewriter) node(node Node) Node {
+	switch n := node.(type) {
+	case *Template:
+		n.Blocks = r.blocks(n.Blocks)
+
+	case *TextBlock, *CommentBlock, *RawBlock:
+		// nothing to do
+
+	case *DisplayBlock:
+		n.Value = r.expr(n.Value)
+
+	case *IfBlock:
+		for i := range n.Branches {
+			branch := &n.Branches[i]
+			branch.Condition = r.expr(branch.Condition)
+			branch.Consequence = r.blocks(branch.Consequence)
+		}
+		if n.Alternative != nil {
+			*n.Alternative = r.blocks(*n.Alternative)
+		}
+
+	case *SwitchBlock:
+		n.Value = r.expr(n.Value)
+		for i := range n.Cases {
+			c := &n.Cases[i]
+			c.Values = r.exprs(c.Values)
+			c.Body = r.blocks(c.Body)
+		}
+		if n.Default != nil {
+			*n.Default = r.blocks(*n.Default)
+		}
+
+	case *ForBlock:
+		r.ident(&n.Variable)
+		n.Iterable = r.expr(n.Iterable)
+		n.Body = r.blocks(n.Body)
+		if n.Alternative != nil {
+			*n.Alternative = r.blocks(*n.Alternative)
+		}
+
+	case *IncludeBlock:
+		r.literal(&n.Path)
+
+	case *ExtendsBlock:
+		r.literal(&n.Path)
+
+	case *ImportBlock:
+		r.literal(&n.Path)
+
+	case *NamedBlock:
+		r.ident(&n.Name)
+		n.Body = r.blocks(n.Body)
+
+	case *MacroBlock:
+		r.ident(&n.Name)
+		for i := range n.Parameters {
+			r.ident(&n.Parameters[i])
+		}
+		n.Body = r.blocks(n.Body)
+
+	case *SetBlock:
+		r.ident(&n.Name)
+		n.Value = r.expr(n.Value)
+
+	case *BasicLiteral, *Identifier:
+		// nothing to do
+
+	case *UnaryExpr:
+		n.Operand = r.expr(n.Operand)
+
+	case *BinaryExpr:
+		n.LOperand = r.expr(n.LOperand)
+		n.ROperand = r.expr(n.ROperand)
+
+	case *ParenExpr:
+		n.Value = r.expr(n.Value)
+
+	case *ListLiteral:
+		n.Elements = r.exprs(n.Elements)
+
+	case *MemberExpr:
+		n.Object = r.expr(n.Object)
+		r.ident(&n.Member)
+
+	case *CallExpr:
+		r.ident(&n.Function)
+		n.Arguments = r.exprs(n.Arguments)
+
+	case *PipeExpr:
+		n.Argument = r.expr(n.Argument)
+		r.ident(&n.Function)
+		n.Arguments = r.exprs(n.Arguments)
+
+	case *ConditionalExpr:
+		n.Condition = r.expr(n.Condition)
+		n.Consequence = r.expr(n.Consequence)
+		n.Alternative = r.expr(n.Alternative)
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return r.f(node)
+}
+
+func (r *rewriter) blocks(blocks []Block) []Block {
+	// Blocks are removed in place.
+	result := blocks[:0]
+	for _, b := range blocks {
+		n := r.node(b)
+		if n == nil {
+			continue
+		}
+		block, ok := n.(Block)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: cannot replace block %T with %T", b, n))
+		}
+		result = append(result, block)
+	}
+	clear(blocks[len(result):])
+	return result
+}
+
+// expr rewrites x, which is nil in incomplete expressions.
+func (r *rewriter) expr(x Expr) Expr {
+	if x == nil {
+		return nil
+	}
+	n := r.node(x)
+	expr, ok := n.(Expr)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace expression %T with %T", x, n))
+	}
+	return expr
+}
+
+func (r *rewriter) exprs(list []Expr) []Expr {
+	for i, x := range list {
+		list[i] = r.expr(x)
+	}
+	return list
+}
+
+func (r *rewriter) ident(ident *Identifier) {
+	n := r.node(ident)
+	replacement, ok := n.(*Identifier)
+	if !ok || replacement == nil {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace identifier with %T", n))
+	}
+	*ident = *replacement
+}
+
+func (r *rewriter) literal(lit *BasicLiteral) {
+	n := r.node(lit)
+	replacement, ok := n.(*BasicLiteral)
+	if !ok || replacement == nil {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace literal with %T", n))
+	}
+	*lit = *replacement
+}
@@ -0,0 +1,96 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/format"
+	"github.com/vietmpl/vie/parse"
+)
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	source := "a{% for x in xs %}{{ x.y | f(1) }}{% else %}{% set z = [-n] %}{% end %}"
+	template, err := parse.Source([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []string
+	ast.Inspect(template, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		nodes = append(nodes, source[n.Start().Offset:n.End().Offset])
+		// Set blocks are not entered.
+		_, ok := n.(*ast.SetBlock)
+		return !ok
+	})
+	expected := []string{
+		source,
+		"a",
+		"{% for x in xs %}{{ x.y | f(1) }}{% else %}{% set z = [-n] %}{% end %}",
+		"x",
+		"xs",
+		"{{ x.y | f(1) }}",
+		"x.y | f(1)",
+		"x.y",
+		"x",
+		"y",
+		"f",
+		"1",
+		"{% set z = [-n] %}",
+	}
+	if got, want := strings.Join(nodes, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Errorf("expected nodes\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+
+	source := "{% if old %}{# a #}{{ old.y | @upper }}{% end %}{{ (1) }}"
+	template, err := parse.Source([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	ast.Rewrite(template, func(n ast.Node) ast.Node {
+		order = append(order, fmt.Sprintf("%T", n))
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if n.Value == "old" {
+				return &ast.Identifier{Start_: n.Start_, End_: n.End_, Value: "new"}
+			}
+		case *ast.CommentBlock:
+			return nil
+		case *ast.ParenExpr:
+			return n.Value
+		}
+		return n
+	})
+
+	expected := "{% if new %}{{ new.y | @upper }}{% end %}{{ 1 }}"
+	if got := string(format.Options{}.Template(template)); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if order[0] != "*ast.Identifier" || order[len(order)-1] != "*ast.Template" {
+		t.Errorf("expected children to be rewritten first, got %v", order)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when replacing an expression with a block")
+		}
+	}()
+	ast.Rewrite(template, func(n ast.Node) ast.Node {
+		if _, ok := n.(ast.Expr); ok {
+			return &ast.TextBlock{}
+		}
+		return n
+	})
+}
@@ -12,10 +12,7 @@ import (
 func LookupFunction(ident ast.Identifier) (value.Function, error) {
 	name := ident.Value
 	if name[0] != '@' {
-		return value.Function{}, fmt.Errorf(
-			"function %s is undefined. Only builtin functions (starting with '@') are supported, user-defined functions are not yet implemented",
-			name,
-		)
+		return value.Function{}, fmt.Errorf("function %s is undefined", name)
 	}
 	fn, exists := functions[name[1:]]
 	if !exists {
@@ -103,6 +100,43 @@ var functions = map[string]value.Function{
 		ReturnType: value.TypeString,
 		Impl:       snake,
 	},
+	"len": {
+		Name:       "len",
+		ArgTypes:   []value.Type{value.ListType{}},
+		ReturnType: value.TypeInt,
+		Impl:       length,
+	},
+	"join": {
+		Name:       "join",
+		ArgTypes:   []value.Type{value.ListType{Elem: value.TypeString}, value.TypeString},
+		ReturnType: value.TypeString,
+		Impl:       join,
+	},
+	"split": {
+		Name:       "split",
+		ArgTypes:   []value.Type{value.TypeString, value.TypeString},
+		ReturnType: value.ListType{Elem: value.TypeString},
+		Impl:       split,
+	},
+	"contains": {
+		Name:       "contains",
+		ArgTypes:   []value.Type{value.ListType{Elem: value.TypeString}, value.TypeString},
+		ReturnType: value.TypeBool,
+		Impl:       contains,
+	},
+	"replace": {
+		Name:       "replace",
+		ArgTypes:   []value.Type{value.TypeString, value.TypeString, value.TypeString},
+		ReturnType: value.TypeString,
+		Impl:       replace,
+	},
+	// safe marks a string as already escaped for the output.
+	"safe": {
+		Name:       "safe",
+		ArgTypes:   []value.Type{value.TypeString},
+		ReturnType: value.TypeString,
+		Impl:       safe,
+	},
 }
 
 func upper(args []value.Value) value.Value {
@@ -251,6 +285,61 @@ func snake(args []value.Value) value.Value {
 	return value.String(strings.Join(words, "_"))
 }
 
+func length(args []value.Value) value.Value {
+	list := args[0].(value.List)
+	return value.Int(len(list))
+}
+
+func join(args []value.Value) value.Value {
+	list := args[0].(value.List)
+	sep := args[1].(value.String)
+
+	elems := make([]string, len(list))
+	for i, elem := range list {
+		elems[i] = string(elem.(value.String))
+	}
+	return value.String(strings.Join(elems, string(sep)))
+}
+
+func split(args []value.Value) value.Value {
+	s := args[0].(value.String)
+	sep := args[1].(value.String)
+
+	if len(s) == 0 {
+		return value.List{}
+	}
+
+	parts := strings.Split(string(s), string(sep))
+	list := make(value.List, len(parts))
+	for i, part := range parts {
+		list[i] = value.String(part)
+	}
+	return list
+}
+
+func contains(args []value.Value) value.Value {
+	list := args[0].(value.List)
+	s := args[1].(value.String)
+
+	for _, elem := range list {
+		if elem.(value.String) == s {
+			return value.Bool(true)
+		}
+	}
+	return value.Bool(false)
+}
+
+func replace(args []value.Value) value.Value {
+	s := args[0].(value.String)
+	old := args[1].(value.String)
+	new := args[2].(value.String)
+	return value.String(strings.ReplaceAll(string(s), string(old), string(new)))
+}
+
+func safe(args []value.Value) value.Value {
+	return args[0]
+}
+
 func splitWords(s string) []string {
 	var words []string
 	var buf []rune
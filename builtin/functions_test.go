@@ -1,6 +1,7 @@
 package builtin
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/vietmpl/vie/value"
@@ -195,3 +196,101 @@ func TestSnakeFunc(t *testing.T) {
 	}
 	runFuncTests(t, snake, tests)
 }
+
+func TestLenFunc(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		list value.List
+		want value.Int
+	}{
+		{value.List{}, 0},
+		{value.List{value.String("a")}, 1},
+		{value.List{value.String("a"), value.Bool(true)}, 2},
+	}
+	for _, tt := range tests {
+		got := length([]value.Value{tt.list})
+		if tt.want != got {
+			t.Errorf("expected %d, got %d", tt.want, got)
+		}
+	}
+}
+
+func TestJoinFunc(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		list value.List
+		sep  value.String
+		want value.String
+	}{
+		{value.List{}, ", ", ""},
+		{value.List{value.String("a")}, ", ", "a"},
+		{value.List{value.String("a"), value.String("b")}, ", ", "a, b"},
+	}
+	for _, tt := range tests {
+		got := join([]value.Value{tt.list, tt.sep})
+		if tt.want != got {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestSplitFunc(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		s    value.String
+		sep  value.String
+		want value.List
+	}{
+		{"", ",", value.List{}},
+		{"a", ",", value.List{value.String("a")}},
+		{"a,b", ",", value.List{value.String("a"), value.String("b")}},
+		{"a,", ",", value.List{value.String("a"), value.String("")}},
+	}
+	for _, tt := range tests {
+		got := split([]value.Value{tt.s, tt.sep})
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("expected %v, got %v", tt.want, got)
+		}
+	}
+}
+
+func TestContainsFunc(t *testing.T) {
+	t.Parallel()
+	list := value.List{value.String("a"), value.String("b")}
+	tests := []struct {
+		s    value.String
+		want value.Bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		got := contains([]value.Value{list, tt.s})
+		if tt.want != got {
+			t.Errorf("%q: expected %v, got %v", tt.s, tt.want, got)
+		}
+	}
+}
+
+func TestReplaceFunc(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		s    value.String
+		old  value.String
+		new  value.String
+		want value.String
+	}{
+		{"", "-", "_", ""},
+		{"a-b-c", "-", "_", "a_b_c"},
+		{"abc", "-", "_", "abc"},
+		{"aaa", "a", "", ""},
+	}
+	for _, tt := range tests {
+		got := replace([]value.Value{tt.s, tt.old, tt.new})
+		if tt.want != got {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
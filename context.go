@@ -2,14 +2,20 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/spf13/cobra"
 	"github.com/vietmpl/vie/analysis"
 	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/template"
+	"github.com/vietmpl/vie/value"
 )
 
 func newCmdContext() *cobra.Command {
+	var delimiters parse.Delimiters
+
 	cmd := &cobra.Command{
 		// TODO(skewb1k): come up with better name.
 		Use:  "context PATH",
@@ -22,12 +28,22 @@ func newCmdContext() *cobra.Command {
 				return err
 			}
 
-			f, err := parse.Source(src)
+			parseOptions, err := fileParseOptions(path, delimiters)
+			if err != nil {
+				return err
+			}
+			f, err := parseOptions.File(path, src)
 			if err != nil {
 				return err
 			}
 
+			include := template.IncludeFrom(templateRoot(path), parseOptions)
+			if err := template.ResolveExtends(f, include); err != nil {
+				return err
+			}
+
 			analyzer := analysis.NewAnalyzer()
+			analyzer.Include = include
 			analyzer.Template(f, path)
 			tm, diagnostics := analyzer.Results()
 			if diagnostics != nil {
@@ -36,17 +52,33 @@ func newCmdContext() *cobra.Command {
 			}
 			// TODO(skewb1k): improve output format.
 			for varname, typ := range tm {
-				fmt.Printf("%s: %s\n", varname, typ.String())
+				printType(varname, typ, "")
 			}
 			return nil
 		},
 	}
+
+	addDelimitersFlag(cmd, &delimiters)
+
 	return cmd
 }
 
+// printType prints the type of a variable. Fields of maps are printed on
+// separate lines, indented under the map.
+func printType(name string, typ value.Type, indent string) {
+	m, ok := typ.(value.MapType)
+	if !ok || m.Fields == nil {
+		fmt.Printf("%s%s: %s\n", indent, name, typ)
+		return
+	}
+	fmt.Printf("%s%s:\n", indent, name)
+	for _, field := range slices.Sorted(maps.Keys(*m.Fields)) {
+		printType(field, (*m.Fields)[field], indent+"  ")
+	}
+}
+
 func printDiagnostics(diagnostics []analysis.Diagnostic) {
 	for _, d := range diagnostics {
-		pos := d.Pos()
-		fmt.Printf("%s:%d:%d: %s\n", d.Path(), pos.Line, pos.Column, d.String())
+		fmt.Printf("%s:%s: %s\n", d.Path(), d.Pos(), d.String())
 	}
 }
@@ -15,6 +15,7 @@ import (
 func newCmdFormat() *cobra.Command {
 	var check bool
 	var stdin bool
+	var options format.Options
 
 	cmd := &cobra.Command{
 		Use:  "format PATH",
@@ -25,7 +26,7 @@ func newCmdFormat() *cobra.Command {
 				if err != nil {
 					return err
 				}
-				formatted, err := format.Source(src)
+				formatted, err := options.Source(src)
 				if err != nil {
 					return err
 				}
@@ -62,7 +63,7 @@ func newCmdFormat() *cobra.Command {
 					if d.IsDir() || filepath.Ext(d.Name()) != ".vie" {
 						return nil
 					}
-					c, err := formatFile(path, check)
+					c, err := formatFile(path, options, check)
 					if err != nil {
 						return err
 					}
@@ -72,7 +73,7 @@ func newCmdFormat() *cobra.Command {
 					return err
 				}
 			} else {
-				changed, err = formatFile(path, check)
+				changed, err = formatFile(path, options, check)
 				if err != nil {
 					return err
 				}
@@ -86,11 +87,12 @@ func newCmdFormat() *cobra.Command {
 
 	cmd.Flags().BoolVarP(&check, "check", "c", false, "List non-conforming files and exit with an error if the list is non-empty")
 	cmd.Flags().BoolVar(&stdin, "stdin", false, "Read input from stdin and write formatted output to stdout")
+	addDelimitersFlag(cmd, &options.Delimiters)
 
 	return cmd
 }
 
-func formatFile(path string, check bool) (changed bool, err error) {
+func formatFile(path string, options format.Options, check bool) (changed bool, err error) {
 	f, err := os.OpenFile(path, os.O_RDWR, 0)
 	if err != nil {
 		return
@@ -100,10 +102,16 @@ func formatFile(path string, check bool) (changed bool, err error) {
 	if err != nil {
 		return
 	}
-	formatted, err := format.Source(src)
+	parseOptions, err := fileParseOptions(path, options.Delimiters)
 	if err != nil {
 		return
 	}
+	options.Delimiters = parseOptions.Delimiters
+	template, err := parseOptions.File(path, src)
+	if err != nil {
+		return
+	}
+	formatted := options.Template(template)
 
 	// Ignore if content has not changed
 	if bytes.Equal(src, formatted) {
@@ -6,9 +6,24 @@ import (
 	"github.com/vietmpl/vie/parse"
 )
 
+// Options configures how templates are formatted.
+type Options struct {
+	// Delimiters are the delimiters of tags, used both to parse and to
+	// print templates. The zero value selects [parse.DefaultDelimiters].
+	Delimiters parse.Delimiters
+}
+
 // Template formats parsed Vie template and returns the result.
 func Template(template *ast.Template) []byte {
-	var p printer
+	return Options{}.Template(template)
+}
+
+// Template formats parsed Vie template using the options o and returns the
+// result.
+func (o Options) Template(template *ast.Template) []byte {
+	p := printer{
+		delimiters: o.Delimiters.WithDefaults(),
+	}
 	p.printBlocks(template.Blocks)
 	return p.buffer.Bytes()
 }
@@ -17,10 +32,16 @@ func Template(template *ast.Template) []byte {
 //
 // For already parsed templates, use [Template].
 func Source(src []byte) ([]byte, error) {
-	template, err := parse.Source(src)
+	return Options{}.Source(src)
+}
+
+// Source formats raw Vie template source using the options o and returns
+// the result or a syntax error.
+func (o Options) Source(src []byte) ([]byte, error) {
+	template, err := parse.Options{Delimiters: o.Delimiters}.Source(src)
 	if err != nil {
 		return nil, err
 	}
 
-	return Template(template), nil
+	return o.Template(template), nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/vietmpl/vie/format"
+	"github.com/vietmpl/vie/parse"
 )
 
 var stableTests = [...]struct {
@@ -26,6 +27,10 @@ var stableTests = [...]struct {
 		"pipe",
 		"{{ foo | bar }}",
 	},
+	{
+		"pipe with arguments",
+		"{{ name | @replace(\"-\", \"_\") | @upper }}",
+	},
 	{
 		"binary operators",
 		"{{ a ~ b or c == d and e != g }}",
@@ -50,6 +55,14 @@ var stableTests = [...]struct {
 		"single space comment",
 		"{# #}",
 	},
+	{
+		"multiline comment",
+		"{#\nline 1\n\n    line 2\n#}",
+	},
+	{
+		"inline multiline comment",
+		"{# line 1\n   line 2 #}",
+	},
 	{
 		"multiline if block",
 		"a\n{% if true %}\nb\n{% end %}\nc",
@@ -62,6 +75,74 @@ var stableTests = [...]struct {
 		"multiple elseif's",
 		"{% if a %}\n{% elseif b %}\n{% elseif c %}\n{% else %}\n{% end %}",
 	},
+	{
+		"switch block",
+		"{% switch db %}\n{% case \"postgres\", \"pg\" %}\nA\n{% case \"mysql\" %}\nB\n{% default %}\nC\n{% end %}",
+	},
+	{
+		"for block",
+		"{% for x in xs %}\n{{ x }}\n{% end %}",
+	},
+	{
+		"for else block",
+		"{% for x in xs %}{{ x }}{% else %}none{% end %}",
+	},
+	{
+		"list literal",
+		"{{ @join([a, \"b\"], \",\") }}",
+	},
+	{
+		"empty list literal",
+		"{% for x in [] %}{% end %}",
+	},
+	{
+		"member",
+		"{{ entity.name | @pascal }}",
+	},
+	{
+		"arithmetic operators",
+		"{{ -a + 1 * b - c / 2 % d }}",
+	},
+	{
+		"ordering operators",
+		"{% if a < 1 or a <= 2 or a > 3 or a >= 4 %}{% end %}",
+	},
+	{
+		"in operators",
+		"{% if \"/internal/\" in path or kind not in [\"a\", \"b\"] %}{% end %}",
+	},
+	{
+		"conditional",
+		"{{ exported ? name | @pascal : name | @camel }}",
+	},
+	{
+		"whitespace control",
+		"a\n{{- b -}}\n{#- c -#}\n{%- if d -%}{%- elseif e -%}{%- else -%}{%- end -%}",
+	},
+	{
+		"whitespace control on one side",
+		"{% for x in xs -%}\n{{ x }}\n{%- end %}",
+	},
+	{
+		"include",
+		"{% include \"header.vie\" %}",
+	},
+	{
+		"raw",
+		"{% raw %}\n{{name}} {%if x%}\n{% end %}",
+	},
+	{
+		"set",
+		"{% set n = name | @pascal %}{{ n }}",
+	},
+	{
+		"macro",
+		"{% import \"macros.vie\" %}\n{% macro field(name, typ) %}{{ name }} {{ typ }}{% end %}\n{{ field(\"id\", \"int\") }}",
+	},
+	{
+		"extends",
+		"{% extends \"base.vie\" %}\n{% block body %}\n{{ name }}\n{% end %}",
+	},
 	{
 		"trailing whitespace",
 		"\n{% if true %} \n\n{% end %}\n",
@@ -83,6 +164,76 @@ var transformTests = [...]struct {
 		"{% 	if name  %}{%  end   %}",
 		"{% if name %}{% end %}",
 	},
+	{
+		"fix spaces around for statement",
+		"{%for  x   in xs%}{%end%}",
+		"{% for x in xs %}{% end %}",
+	},
+	{
+		"fix spaces around switch statements",
+		"{%switch  a%} {%case 1,2%}{%default%}{%end%}",
+		"{% switch a %} {% case 1, 2 %}{% default %}{% end %}",
+	},
+	{
+		"adds spaces around arithmetic operators",
+		"{{ a+1 }}",
+		"{{ a + 1 }}",
+	},
+	{
+		"fix spaces around whitespace control",
+		"{%-if a-%}{{-a-}}{%-end-%}",
+		"{%- if a -%}{{- a -}}{%- end -%}",
+	},
+	{
+		"fix spaces around raw tags only",
+		"{%raw%}{{a}}{%end%}",
+		"{% raw %}{{a}}{% end %}",
+	},
+	{
+		"adds spaces around comment",
+		"{#comment#}",
+		"{# comment #}",
+	},
+	{
+		"fix spaces around comment",
+		"{#-  a b  -#}{#   #}",
+		"{#- a b -#}{# #}",
+	},
+	{
+		"fix whitespace in multiline comment",
+		"{#  \n\n  a  \n b\t\n\n  #}{#a\n  b   \n#}",
+		"{#\n  a\n b\n#}{# a\n  b #}",
+	},
+	{
+		"fix spaces in not in",
+		"{% if a not   in b %}{% end %}",
+		"{% if a not in b %}{% end %}",
+	},
+	{
+		"adds spaces around conditional",
+		"{{a?b:c}}",
+		"{{ a ? b : c }}",
+	},
+	{
+		"fix spaces in set",
+		"{%set  n=name%}",
+		"{% set n = name %}",
+	},
+	{
+		"fix spaces in macro parameters",
+		"{% macro m( a,b ) %}{% end %}",
+		"{% macro m(a, b) %}{% end %}",
+	},
+	{
+		"fix spaces in pipe arguments",
+		"{{ a|@replace( \"-\",\"_\" ) }}",
+		"{{ a | @replace(\"-\", \"_\") }}",
+	},
+	{
+		"fix spaces in list literal",
+		"{{ @join([ a,b ], \"\") }}",
+		"{{ @join([a, b], \"\") }}",
+	},
 }
 
 func TestSource(t *testing.T) {
@@ -103,6 +254,57 @@ func TestSource(t *testing.T) {
 	}
 }
 
+var delimitersTests = [...]struct {
+	name           string
+	source         string
+	expectedSource string
+}{
+	{
+		"custom delimiters",
+		"[[name]] [%if a-%]b[%-end%] [#c#]",
+		"[[ name ]] [% if a -%]b[%- end %] [# c #]",
+	},
+	{
+		"default delimiters are text",
+		"{{ x }} {% y %} {# z #}[[x]]",
+		"{{ x }} {% y %} {# z #}[[ x ]]",
+	},
+	{
+		"raw block with custom delimiters",
+		"[%raw%][[ x ]]{{ y }}[%end%]",
+		"[% raw %][[ x ]]{{ y }}[% end %]",
+	},
+}
+
+func TestDelimiters(t *testing.T) {
+	t.Parallel()
+
+	options := format.Options{
+		Delimiters: parse.Delimiters{
+			DisplayOpen:    "[[",
+			DisplayClose:   "]]",
+			StatementOpen:  "[%",
+			StatementClose: "%]",
+			CommentOpen:    "[#",
+			CommentClose:   "#]",
+		},
+	}
+	for _, test := range delimitersTests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := options.Source([]byte(test.source))
+			if err != nil {
+				t.Error(err)
+			}
+
+			if test.expectedSource != string(actual) {
+				t.Errorf("expected %q, got %q", test.expectedSource, actual)
+			}
+		})
+	}
+}
+
 func expectFormat(t *testing.T, source, expectedSource string) {
 	t.Helper()
 
@@ -3,12 +3,15 @@ package format
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
 )
 
 type printer struct {
-	buffer bytes.Buffer
+	delimiters parse.Delimiters
+	buffer     bytes.Buffer
 }
 
 func (p *printer) printBlocks(b []ast.Block) {
@@ -23,41 +26,208 @@ func (p *printer) printBlock(b ast.Block) {
 		p.buffer.WriteString(block.Content)
 
 	case *ast.CommentBlock:
-		// TODO(skewb1k): format leading/trailing whitespaces.
-		p.buffer.WriteString("{#")
+		p.printComment(block)
+
+	case *ast.RawBlock:
+		p.printKeywordTag("raw", block.Trim)
 		p.buffer.WriteString(block.Content)
-		p.buffer.WriteString("#}")
+		p.printKeywordTag("end", block.EndTrim)
 
 	case *ast.DisplayBlock:
-		p.buffer.WriteString("{{ ")
+		p.printOpen(p.delimiters.DisplayOpen, block.Trim)
 		p.printExpr(block.Value)
-		p.buffer.WriteString(" }}")
+		p.printClose(p.delimiters.DisplayClose, block.Trim)
 
 	case *ast.IfBlock:
-		p.buffer.WriteString("{% if ")
 		branch0 := block.Branches[0]
+		p.printOpen(p.delimiters.StatementOpen, branch0.Trim)
+		p.buffer.WriteString("if ")
 		p.printExpr(branch0.Condition)
-		p.buffer.WriteString(" %}")
+		p.printClose(p.delimiters.StatementClose, branch0.Trim)
 		p.printBlocks(branch0.Consequence)
 
 		for _, branch := range block.Branches[1:] {
-			p.buffer.WriteString("{% elseif ")
+			p.printOpen(p.delimiters.StatementOpen, branch.Trim)
+			p.buffer.WriteString("elseif ")
 			p.printExpr(branch.Condition)
-			p.buffer.WriteString(" %}")
+			p.printClose(p.delimiters.StatementClose, branch.Trim)
 			p.printBlocks(branch.Consequence)
 		}
 
 		if block.Alternative != nil {
-			p.buffer.WriteString("{% else %}")
+			p.printKeywordTag("else", block.ElseTrim)
+			p.printBlocks(*block.Alternative)
+		}
+		p.printKeywordTag("end", block.EndTrim)
+
+	case *ast.SwitchBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("switch ")
+		p.printExpr(block.Value)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+		p.buffer.WriteString(block.Space)
+
+		for _, c := range block.Cases {
+			p.printOpen(p.delimiters.StatementOpen, c.Trim)
+			p.buffer.WriteString("case ")
+			p.printExprList(c.Values)
+			p.printClose(p.delimiters.StatementClose, c.Trim)
+			p.printBlocks(c.Body)
+		}
+
+		if block.Default != nil {
+			p.printKeywordTag("default", block.DefaultTrim)
+			p.printBlocks(*block.Default)
+		}
+		p.printKeywordTag("end", block.EndTrim)
+
+	case *ast.ForBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("for ")
+		p.buffer.WriteString(block.Variable.Value)
+		p.buffer.WriteString(" in ")
+		p.printExpr(block.Iterable)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+		p.printBlocks(block.Body)
+
+		if block.Alternative != nil {
+			p.printKeywordTag("else", block.ElseTrim)
 			p.printBlocks(*block.Alternative)
 		}
-		p.buffer.WriteString("{% end %}")
+		p.printKeywordTag("end", block.EndTrim)
+
+	case *ast.IncludeBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("include ")
+		p.printExpr(&block.Path)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+
+	case *ast.ExtendsBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("extends ")
+		p.printExpr(&block.Path)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+
+	case *ast.NamedBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("block ")
+		p.buffer.WriteString(block.Name.Value)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+		p.printBlocks(block.Body)
+		p.printKeywordTag("end", block.EndTrim)
+
+	case *ast.MacroBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("macro ")
+		p.buffer.WriteString(block.Name.Value)
+		p.buffer.WriteByte('(')
+		for i, parameter := range block.Parameters {
+			if i > 0 {
+				p.buffer.WriteString(", ")
+			}
+			p.buffer.WriteString(parameter.Value)
+		}
+		p.buffer.WriteByte(')')
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+		p.printBlocks(block.Body)
+		p.printKeywordTag("end", block.EndTrim)
+
+	case *ast.SetBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("set ")
+		p.buffer.WriteString(block.Name.Value)
+		p.buffer.WriteString(" = ")
+		p.printExpr(block.Value)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
+
+	case *ast.ImportBlock:
+		p.printOpen(p.delimiters.StatementOpen, block.Trim)
+		p.buffer.WriteString("import ")
+		p.printExpr(&block.Path)
+		p.printClose(p.delimiters.StatementClose, block.Trim)
 
 	default:
 		panic(fmt.Sprintf("format: unexpected block type %T", b))
 	}
 }
 
+// printOpen writes the opening delimiter of a tag followed by a space,
+// keeping its whitespace control marker.
+func (p *printer) printOpen(delim string, trim ast.Trim) {
+	p.buffer.WriteString(delim)
+	if trim.Left {
+		p.buffer.WriteByte('-')
+	}
+	p.buffer.WriteByte(' ')
+}
+
+// printClose writes a space followed by the closing delimiter of a tag,
+// keeping its whitespace control marker.
+func (p *printer) printClose(delim string, trim ast.Trim) {
+	p.buffer.WriteByte(' ')
+	if trim.Right {
+		p.buffer.WriteByte('-')
+	}
+	p.buffer.WriteString(delim)
+}
+
+// printComment writes a comment with its whitespace normalized. The text
+// of the comment is separated from the delimiters by a space, and its lines
+// lose their trailing whitespace. A multi-line comment starting with a line
+// break keeps the delimiters on their own lines.
+func (p *printer) printComment(c *ast.CommentBlock) {
+	newline := "\n"
+	if strings.Contains(c.Content, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(c.Content, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+	ownLines := len(lines) > 1 && strings.TrimSpace(lines[0]) == ""
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// separator is written between the delimiters and the text.
+	separator := " "
+	switch {
+	case c.Content == "":
+		separator = ""
+	case len(lines) == 0:
+		// Only the separators are left of a blank comment.
+	case ownLines:
+		separator = newline
+	default:
+		lines[0] = strings.TrimLeft(lines[0], " \t")
+	}
+
+	p.buffer.WriteString(p.delimiters.CommentOpen)
+	if c.Trim.Left {
+		p.buffer.WriteByte('-')
+	}
+	p.buffer.WriteString(separator)
+	if len(lines) > 0 {
+		p.buffer.WriteString(strings.Join(lines, newline))
+		p.buffer.WriteString(separator)
+	}
+	if c.Trim.Right {
+		p.buffer.WriteByte('-')
+	}
+	p.buffer.WriteString(p.delimiters.CommentClose)
+}
+
+// printKeywordTag writes a statement tag consisting of a single keyword,
+// such as {% end %}.
+func (p *printer) printKeywordTag(keyword string, trim ast.Trim) {
+	p.printOpen(p.delimiters.StatementOpen, trim)
+	p.buffer.WriteString(keyword)
+	p.printClose(p.delimiters.StatementClose, trim)
+}
+
 func (p *printer) printExpr(e ast.Expr) {
 	switch expr := e.(type) {
 	case *ast.BasicLiteral:
@@ -82,6 +252,16 @@ func (p *printer) printExpr(e ast.Expr) {
 		p.printExpr(expr.Value)
 		p.buffer.WriteByte(')')
 
+	case *ast.ListLiteral:
+		p.buffer.WriteByte('[')
+		p.printExprList(expr.Elements)
+		p.buffer.WriteByte(']')
+
+	case *ast.MemberExpr:
+		p.printExpr(expr.Object)
+		p.buffer.WriteByte('.')
+		p.buffer.WriteString(expr.Member.Value)
+
 	case *ast.CallExpr:
 		p.printExpr(&expr.Function)
 		p.buffer.WriteByte('(')
@@ -92,6 +272,18 @@ func (p *printer) printExpr(e ast.Expr) {
 		p.printExpr(expr.Argument)
 		p.buffer.WriteString(" | ")
 		p.buffer.WriteString(expr.Function.Value)
+		if len(expr.Arguments) > 0 {
+			p.buffer.WriteByte('(')
+			p.printExprList(expr.Arguments)
+			p.buffer.WriteByte(')')
+		}
+
+	case *ast.ConditionalExpr:
+		p.printExpr(expr.Condition)
+		p.buffer.WriteString(" ? ")
+		p.printExpr(expr.Consequence)
+		p.buffer.WriteString(" : ")
+		p.printExpr(expr.Alternative)
 
 	default:
 		panic(fmt.Sprintf("format: unexpected expr type %T", e))
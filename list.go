@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -23,7 +24,9 @@ func newCmdList() *cobra.Command {
 				return err
 			}
 			for _, e := range entries {
-				if e.IsDir() {
+				// Directories starting with an underscore, such as
+				// _partials, are not templates.
+				if e.IsDir() && !strings.HasPrefix(e.Name(), "_") {
 					fmt.Println(e.Name())
 				}
 			}
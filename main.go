@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/vietmpl/vie/parse"
 )
 
 var version = "v0.0.1"
@@ -14,14 +17,14 @@ func main() {
 	log.SetPrefix("error: ")
 
 	root := cobra.Command{
-		Use:          "vie",
-		Version:      version,
-		SilenceUsage: true,
+		Use:           "vie",
+		Version:       version,
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		CompletionOptions: cobra.CompletionOptions{
 			HiddenDefaultCmd: true,
 		},
 	}
-	root.SetErrPrefix("error:")
 
 	root.SetVersionTemplate("{{.Version}}\n")
 	root.InitDefaultVersionFlag()
@@ -33,9 +36,19 @@ func main() {
 		newCmdRender(),
 		newCmdNew(),
 		newCmdList(),
+		newCmdAST(),
 	)
 
 	if err := root.Execute(); err != nil {
+		// Syntax errors are printed one per line as path:line:col: message.
+		var syntaxErrors parse.ErrorList
+		if errors.As(err, &syntaxErrors) {
+			for _, e := range syntaxErrors {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		} else {
+			log.Print(err)
+		}
 		os.Exit(1)
 	}
 }
@@ -6,10 +6,15 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/render"
 	"github.com/vietmpl/vie/template"
 )
 
 func newCmdNew() *cobra.Command {
+	var options render.Options
+	var delimiters parse.Delimiters
+
 	cmd := &cobra.Command{
 		Use:     "new TEMPLATE DEST [VAR=VALUE...] [VAR...]",
 		Short:   "Render a template in the target directory",
@@ -20,16 +25,21 @@ func newCmdNew() *cobra.Command {
 			dest := args[1]
 
 			tmplPath := filepath.Join(".vie", tmplName)
-			tmpl, err := template.FromDir(tmplPath)
+			tmpl, err := template.FromDir(tmplPath, delimiters)
 			if err != nil {
 				return err
 			}
+			tmpl.Options = options
 
 			dataArgs := args[2:]
 			data, err := parseData(dataArgs)
 			if err != nil {
 				return err
 			}
+			types, _ := tmpl.Analyze()
+			if err := coerceData(types, data); err != nil {
+				return err
+			}
 
 			files, err := tmpl.Render(data)
 			if err != nil {
@@ -61,5 +71,9 @@ func newCmdNew() *cobra.Command {
 			return nil
 		},
 	}
+
+	addRenderFlags(cmd, &options)
+	addDelimitersFlag(cmd, &delimiters)
+
 	return cmd
 }
@@ -0,0 +1,350 @@
+package parse_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+)
+
+// corpusTests are the conformance tests of the parser, taken from the test
+// corpus of the tree-sitter grammar the parser replaces. Trees are written
+// as S-expressions with the node names of the grammar, followed by the text
+// of leaves.
+var corpusTests = [...]struct {
+	name   string
+	source string
+	tree   string
+}{
+	{
+		"empty",
+		"",
+		"(template)",
+	},
+	{
+		"text",
+		"a { b } c %}",
+		`(template (text "a { b } c %}"))`,
+	},
+	{
+		"comment",
+		"{# a #}{##}{#- b\n  c -#}",
+		`(template (comment_tag " a ") (comment_tag) (comment_tag " b\n  c "))`,
+	},
+	{
+		"raw",
+		"{% raw %}{{ a }}{% if %}{%- end -%}",
+		`(template (raw_block "{{ a }}{% if %}"))`,
+	},
+	{
+		"literals",
+		"{{ [1, \"a\\n\", 'b', `c\\`, true, false, []] }}",
+		"(template (display_tag (list_literal (integer_literal 1) (string_literal \"a\\n\") (string_literal 'b') (string_literal `c\\`) (boolean_literal true) (boolean_literal false) (list_literal))))",
+	},
+	{
+		"precedence",
+		"{{ a or b and c == d ~ e + f * g }}",
+		`(template (display_tag (binary_expression (identifier a) "or" (binary_expression (identifier b) "and" (binary_expression (identifier c) "==" (binary_expression (identifier d) "~" (binary_expression (identifier e) "+" (binary_expression (identifier f) "*" (identifier g)))))))))`,
+	},
+	{
+		"left-associative",
+		"{{ a - b - c }}",
+		`(template (display_tag (binary_expression (binary_expression (identifier a) "-" (identifier b)) "-" (identifier c))))`,
+	},
+	{
+		"not-in",
+		"{{ a not\n in b }}{{ a in b }}",
+		`(template (display_tag (binary_expression (identifier a) "not in" (identifier b))) (display_tag (binary_expression (identifier a) "in" (identifier b))))`,
+	},
+	{
+		"unary",
+		"{{ !-a | f == !b }}",
+		`(template (display_tag (binary_expression (pipe_expression (unary_expression "!" (unary_expression "-" (identifier a))) (identifier f)) "==" (unary_expression "!" (identifier b)))))`,
+	},
+	{
+		"pipe",
+		"{{ a ~ b | @upper | f(1, c) }}",
+		`(template (display_tag (binary_expression (identifier a) "~" (pipe_expression (pipe_expression (identifier b) (identifier @upper)) (identifier f) (arguments (integer_literal 1) (identifier c))))))`,
+	},
+	{
+		"call-member",
+		"{{ f().a.b }}{{ g(x, (y)) }}",
+		`(template (display_tag (member_expression (member_expression (call_expression (identifier f) (arguments)) (identifier a)) (identifier b))) (display_tag (call_expression (identifier g) (arguments (identifier x) (parenthesized_expression (identifier y))))))`,
+	},
+	{
+		"conditional",
+		"{{ a ? b : c ? d : e }}",
+		`(template (display_tag (conditional_expression (identifier a) (identifier b) (conditional_expression (identifier c) (identifier d) (identifier e)))))`,
+	},
+	{
+		"if",
+		"{% if a %}1{% elseif b %}2{% else %}3{% end %}",
+		`(template (if_tag (identifier a) (text "1") (elseif_tag (identifier b) (text "2")) (else_tag (text "3"))))`,
+	},
+	{
+		"trim",
+		"a {{- b -}} c {%- if x -%} d {%- end -%}",
+		`(template (text "a ") (display_tag (identifier b)) (text " c ") (if_tag (identifier x) (text " d ")))`,
+	},
+	{
+		"for",
+		"{% for x in xs %}{{ x }}{% else %}none{% end %}",
+		`(template (for_tag (identifier x) (identifier xs) (display_tag (identifier x)) (else_tag (text "none"))))`,
+	},
+	{
+		"switch",
+		"{% switch x %}\n  {% case 1, 2 %}a{% case 3 %}{% default %}b{% end %}",
+		`(template (switch_tag (identifier x) (case_tag (integer_literal 1) (integer_literal 2) (text "a")) (case_tag (integer_literal 3)) (default_tag (text "b"))))`,
+	},
+	{
+		"extends",
+		"{% extends \"base\" %}{% block body %}a{% end %}",
+		`(template (extends_tag (string_literal "base")) (block_tag (identifier body) (text "a")))`,
+	},
+	{
+		"include-import",
+		"{% include 'a' %}{% import \"b\" %}",
+		`(template (include_tag (string_literal 'a')) (import_tag (string_literal "b")))`,
+	},
+	{
+		"set",
+		"{% set x = [a] %}",
+		`(template (set_tag (identifier x) (list_literal (identifier a))))`,
+	},
+	{
+		"macro",
+		"{% macro m(a, b) %}{{ a }}{% end %}{% macro n() %}{% end %}",
+		`(template (macro_tag (identifier m) (parameter_list (identifier a) (identifier b)) (display_tag (identifier a))) (macro_tag (identifier n) (parameter_list)))`,
+	},
+}
+
+func TestCorpus(t *testing.T) {
+	t.Parallel()
+	for _, test := range corpusTests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			template, err := parse.Source([]byte(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			b.WriteString("(template")
+			writeBlocks(&b, template.Blocks)
+			b.WriteString(")")
+			if tree := b.String(); tree != test.tree {
+				t.Errorf("expected\n%s\ngot\n%s", test.tree, tree)
+			}
+		})
+	}
+}
+
+func TestCorpusDelimiters(t *testing.T) {
+	t.Parallel()
+
+	options := parse.Options{
+		Delimiters: parse.Delimiters{
+			DisplayOpen:    "[[",
+			DisplayClose:   "]]",
+			StatementOpen:  "<%",
+			StatementClose: "%>",
+			CommentOpen:    "<#",
+			CommentClose:   "#>",
+		},
+	}
+	source := "{{ a }}<# b #><% if [[1]] == [] %>[[- c | f -]]<% end %>"
+	template, err := options.Source([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	writeBlocks(&b, template.Blocks)
+	expected := ` (text "{{ a }}") (comment_tag " b ") (if_tag (binary_expression (list_literal (list_literal (integer_literal 1))) "==" (list_literal)) (display_tag (pipe_expression (identifier c) (identifier f))))`
+	if tree := b.String(); tree != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, tree)
+	}
+}
+
+// writeBlocks writes the S-expressions of blocks, each preceded by a space.
+func writeBlocks(b *strings.Builder, blocks []ast.Block) {
+	for _, block := range blocks {
+		b.WriteString(" ")
+		writeBlock(b, block)
+	}
+}
+
+func writeBlock(b *strings.Builder, block ast.Block) {
+	switch block := block.(type) {
+	case *ast.TextBlock:
+		fmt.Fprintf(b, "(text %q)", block.Content)
+	case *ast.CommentBlock:
+		if block.Content == "" {
+			b.WriteString("(comment_tag)")
+			break
+		}
+		fmt.Fprintf(b, "(comment_tag %q)", block.Content)
+	case *ast.RawBlock:
+		fmt.Fprintf(b, "(raw_block %q)", block.Content)
+	case *ast.DisplayBlock:
+		b.WriteString("(display_tag ")
+		writeExpr(b, block.Value)
+		b.WriteString(")")
+	case *ast.IfBlock:
+		for i, branch := range block.Branches {
+			if i == 0 {
+				b.WriteString("(if_tag ")
+			} else {
+				b.WriteString(" (elseif_tag ")
+			}
+			writeExpr(b, branch.Condition)
+			writeBlocks(b, branch.Consequence)
+			if i > 0 {
+				b.WriteString(")")
+			}
+		}
+		writeElse(b, "else_tag", block.Alternative)
+		b.WriteString(")")
+	case *ast.ForBlock:
+		b.WriteString("(for_tag ")
+		writeExpr(b, &block.Variable)
+		b.WriteString(" ")
+		writeExpr(b, block.Iterable)
+		writeBlocks(b, block.Body)
+		writeElse(b, "else_tag", block.Alternative)
+		b.WriteString(")")
+	case *ast.SwitchBlock:
+		b.WriteString("(switch_tag ")
+		writeExpr(b, block.Value)
+		for _, c := range block.Cases {
+			b.WriteString(" (case_tag")
+			for _, value := range c.Values {
+				b.WriteString(" ")
+				writeExpr(b, value)
+			}
+			writeBlocks(b, c.Body)
+			b.WriteString(")")
+		}
+		writeElse(b, "default_tag", block.Default)
+		b.WriteString(")")
+	case *ast.IncludeBlock:
+		b.WriteString("(include_tag ")
+		writeExpr(b, &block.Path)
+		b.WriteString(")")
+	case *ast.ExtendsBlock:
+		b.WriteString("(extends_tag ")
+		writeExpr(b, &block.Path)
+		b.WriteString(")")
+	case *ast.ImportBlock:
+		b.WriteString("(import_tag ")
+		writeExpr(b, &block.Path)
+		b.WriteString(")")
+	case *ast.NamedBlock:
+		b.WriteString("(block_tag ")
+		writeExpr(b, &block.Name)
+		writeBlocks(b, block.Body)
+		b.WriteString(")")
+	case *ast.SetBlock:
+		b.WriteString("(set_tag ")
+		writeExpr(b, &block.Name)
+		b.WriteString(" ")
+		writeExpr(b, block.Value)
+		b.WriteString(")")
+	case *ast.MacroBlock:
+		b.WriteString("(macro_tag ")
+		writeExpr(b, &block.Name)
+		b.WriteString(" (parameter_list")
+		for _, parameter := range block.Parameters {
+			b.WriteString(" ")
+			writeExpr(b, &parameter)
+		}
+		b.WriteString(")")
+		writeBlocks(b, block.Body)
+		b.WriteString(")")
+	default:
+		panic(fmt.Sprintf("unexpected block type %T", block))
+	}
+}
+
+// writeElse writes the blocks following an else or default tag, if any.
+func writeElse(b *strings.Builder, tag string, blocks *[]ast.Block) {
+	if blocks == nil {
+		return
+	}
+	b.WriteString(" (" + tag)
+	writeBlocks(b, *blocks)
+	b.WriteString(")")
+}
+
+func writeExpr(b *strings.Builder, expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.BasicLiteral:
+		kind := map[ast.BasicLitKind]string{
+			ast.KindBool:   "boolean_literal",
+			ast.KindString: "string_literal",
+			ast.KindInt:    "integer_literal",
+		}[expr.Kind]
+		fmt.Fprintf(b, "(%s %s)", kind, expr.Value)
+	case *ast.Identifier:
+		fmt.Fprintf(b, "(identifier %s)", expr.Value)
+	case *ast.UnaryExpr:
+		fmt.Fprintf(b, "(unary_expression %q ", expr.Operator.String())
+		writeExpr(b, expr.Operand)
+		b.WriteString(")")
+	case *ast.BinaryExpr:
+		b.WriteString("(binary_expression ")
+		writeExpr(b, expr.LOperand)
+		fmt.Fprintf(b, " %q ", expr.Operator.String())
+		writeExpr(b, expr.ROperand)
+		b.WriteString(")")
+	case *ast.ParenExpr:
+		b.WriteString("(parenthesized_expression ")
+		writeExpr(b, expr.Value)
+		b.WriteString(")")
+	case *ast.ListLiteral:
+		b.WriteString("(list_literal")
+		writeExprs(b, expr.Elements)
+		b.WriteString(")")
+	case *ast.MemberExpr:
+		b.WriteString("(member_expression ")
+		writeExpr(b, expr.Object)
+		b.WriteString(" ")
+		writeExpr(b, &expr.Member)
+		b.WriteString(")")
+	case *ast.CallExpr:
+		b.WriteString("(call_expression ")
+		writeExpr(b, &expr.Function)
+		b.WriteString(" (arguments")
+		writeExprs(b, expr.Arguments)
+		b.WriteString("))")
+	case *ast.PipeExpr:
+		b.WriteString("(pipe_expression ")
+		writeExpr(b, expr.Argument)
+		b.WriteString(" ")
+		writeExpr(b, &expr.Function)
+		if expr.RparenLocation != (ast.Location{}) {
+			b.WriteString(" (arguments")
+			writeExprs(b, expr.Arguments)
+			b.WriteString(")")
+		}
+		b.WriteString(")")
+	case *ast.ConditionalExpr:
+		b.WriteString("(conditional_expression ")
+		writeExpr(b, expr.Condition)
+		b.WriteString(" ")
+		writeExpr(b, expr.Consequence)
+		b.WriteString(" ")
+		writeExpr(b, expr.Alternative)
+		b.WriteString(")")
+	default:
+		panic(fmt.Sprintf("unexpected expression type %T", expr))
+	}
+}
+
+// writeExprs writes the S-expressions of exprs, each preceded by a space.
+func writeExprs(b *strings.Builder, exprs []ast.Expr) {
+	for _, expr := range exprs {
+		b.WriteString(" ")
+		writeExpr(b, expr)
+	}
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Delimiters are the character sequences enclosing tags. Empty fields are
+// replaced by the corresponding [DefaultDelimiters].
+type Delimiters struct {
+	DisplayOpen    string
+	DisplayClose   string
+	StatementOpen  string
+	StatementClose string
+	CommentOpen    string
+	CommentClose   string
+}
+
+// DefaultDelimiters are the delimiters used unless configured otherwise.
+var DefaultDelimiters = Delimiters{
+	DisplayOpen:    "{{",
+	DisplayClose:   "}}",
+	StatementOpen:  "{%",
+	StatementClose: "%}",
+	CommentOpen:    "{#",
+	CommentClose:   "#}",
+}
+
+// ParseDelimiters parses delimiters written as six space-separated fields:
+// the opening and closing delimiters of display, statement and comment tags,
+// such as "[[ ]] [% %] [# #]".
+func ParseDelimiters(s string) (Delimiters, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 6 {
+		return Delimiters{}, fmt.Errorf("invalid delimiters %q: expected 6 fields, got %d", s, len(fields))
+	}
+	d := Delimiters{
+		DisplayOpen:    fields[0],
+		DisplayClose:   fields[1],
+		StatementOpen:  fields[2],
+		StatementClose: fields[3],
+		CommentOpen:    fields[4],
+		CommentClose:   fields[5],
+	}
+	opens := [...]string{d.DisplayOpen, d.StatementOpen, d.CommentOpen}
+	for i, open := range opens {
+		for j, other := range opens {
+			if i != j && strings.HasPrefix(other, open) {
+				return Delimiters{}, fmt.Errorf("invalid delimiters %q: %s is ambiguous with %s", s, open, other)
+			}
+		}
+	}
+	return d, nil
+}
+
+// String returns the delimiters in the format accepted by
+// [ParseDelimiters], or an empty string for the zero value.
+func (d Delimiters) String() string {
+	if d == (Delimiters{}) {
+		return ""
+	}
+	d = d.WithDefaults()
+	return strings.Join([]string{
+		d.DisplayOpen, d.DisplayClose,
+		d.StatementOpen, d.StatementClose,
+		d.CommentOpen, d.CommentClose,
+	}, " ")
+}
+
+// MarshalText implements [encoding.TextMarshaler].
+func (d Delimiters) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]. Empty text sets the
+// zero value.
+func (d *Delimiters) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = Delimiters{}
+		return nil
+	}
+	parsed, err := ParseDelimiters(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// WithDefaults returns d with empty fields set to the default delimiters.
+func (d Delimiters) WithDefaults() Delimiters {
+	defaultTo := func(s *string, def string) {
+		if *s == "" {
+			*s = def
+		}
+	}
+	defaultTo(&d.DisplayOpen, DefaultDelimiters.DisplayOpen)
+	defaultTo(&d.DisplayClose, DefaultDelimiters.DisplayClose)
+	defaultTo(&d.StatementOpen, DefaultDelimiters.StatementOpen)
+	defaultTo(&d.StatementClose, DefaultDelimiters.StatementClose)
+	defaultTo(&d.CommentOpen, DefaultDelimiters.CommentOpen)
+	defaultTo(&d.CommentClose, DefaultDelimiters.CommentClose)
+	return d
+}
@@ -0,0 +1,176 @@
+package parse
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vietmpl/vie/ast"
+)
+
+// Document is a template being edited, such as the content of an editor
+// buffer. It keeps the last parsed template, so that an edit only reparses
+// the top-level blocks it touches, reusing the others.
+type Document struct {
+	options Options
+	path    string
+	source  []byte
+	// template is the last parsed template, or nil if the source has
+	// syntax errors.
+	template *ast.Template
+	err      error
+}
+
+// Edit replaces the bytes from Start to End of the source of a [Document]
+// with Text.
+type Edit struct {
+	Start, End int
+	Text       []byte
+}
+
+// Document parses the template source read from the file path like
+// [Options.File], returning a document to apply edits to.
+func (o Options) Document(path string, source []byte) *Document {
+	d := &Document{
+		options: o,
+		path:    path,
+		source:  slices.Clone(source),
+	}
+	d.template, d.err = o.File(path, d.source)
+	return d
+}
+
+// Source returns the current source of d, which must not be modified.
+func (d *Document) Source() []byte {
+	return d.source
+}
+
+// Template returns the template parsed from the current source of d, or the
+// syntax errors of the source.
+func (d *Document) Template() (*ast.Template, error) {
+	return d.template, d.err
+}
+
+// Edit applies edit to the source of d and returns the updated template.
+// The blocks of the previous template are reused by the updated one, so the
+// previous template must not be used after an edit.
+func (d *Document) Edit(edit Edit) (*ast.Template, error) {
+	if edit.Start < 0 || edit.Start > edit.End || edit.End > len(d.source) {
+		return nil, fmt.Errorf("invalid edit range [%d:%d] of %d bytes", edit.Start, edit.End, len(d.source))
+	}
+	d.source = slices.Concat(d.source[:edit.Start], edit.Text, d.source[edit.End:])
+	if d.template != nil {
+		if template := d.reparse(edit); template != nil {
+			d.template = template
+			return d.template, nil
+		}
+	}
+	d.template, d.err = d.options.File(d.path, d.source)
+	return d.template, d.err
+}
+
+// reparse returns the template parsed from the source following edit,
+// reusing the top-level blocks of the previous template outside of it. It
+// returns nil if the blocks around the edit have errors or cannot be parsed
+// apart from the others, leaving them to a full parse.
+func (d *Document) reparse(edit Edit) *ast.Template {
+	blocks := d.template.Blocks
+	// Text extends up to the next tag, so text next to the reparsed blocks
+	// is reparsed as well.
+	i := 0
+	for i < len(blocks) && int(blocks[i].End().Offset) <= edit.Start {
+		i++
+	}
+	for i > 0 && !isTag(blocks[i-1]) {
+		i--
+	}
+	j := len(blocks)
+	for j > i && int(blocks[j-1].Start().Offset) >= edit.End {
+		j--
+	}
+	for j < len(blocks) && !isTag(blocks[j]) {
+		j++
+	}
+	prefix, suffix := blocks[:i], blocks[j:]
+
+	// Offsets of the blocks following the edit move by delta.
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	start, end := 0, len(d.source)
+	if len(prefix) > 0 {
+		start = int(prefix[len(prefix)-1].End().Offset)
+	}
+	if len(suffix) > 0 {
+		end = int(suffix[0].Start().Offset) + delta
+	}
+
+	p := newParser(d.path, string(d.source), d.options.Delimiters.WithDefaults())
+	for _, block := range slices.Concat(prefix, suffix) {
+		for name := range ast.NamedBlocks([]ast.Block{block}) {
+			p.blockNames[name] = true
+		}
+		if macro, ok := block.(*ast.MacroBlock); ok {
+			p.macroNames[macro.Name.Value] = true
+		}
+	}
+	p.lexer.source = p.source[:end]
+	p.lexer.offset = start
+	p.next()
+	middle, _ := p.parseBody()
+	if len(middle) > 0 && len(suffix) > 0 {
+		// Text at the end of the reparsed blocks must not run into the
+		// following tag, as in `{` followed by `{ x }}`.
+		last := middle[len(middle)-1]
+		if text := int(last.Start().Offset); !isTag(last) && text+p.lexer.textEnd(p.source[text:]) != end {
+			return nil
+		}
+	}
+
+	for _, block := range suffix {
+		relocate(block, func(location *ast.Location) {
+			*location = p.locationAt(int(location.Offset) + delta)
+		})
+	}
+	var template ast.Template
+	template.Blocks = append(template.Blocks, prefix...)
+	template.Blocks = append(template.Blocks, middle...)
+	template.Blocks = append(template.Blocks, suffix...)
+	p.checkExtends(template.Blocks)
+	if len(p.errors) > 0 {
+		return nil
+	}
+	return &template
+}
+
+// relocate calls move with every location of the node n and the nodes
+// inside it.
+func relocate(n ast.Node, move func(*ast.Location)) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case ast.Block:
+			span := spanOf(n)
+			move(&span.Start_)
+			move(&span.End_)
+		case *ast.BasicLiteral:
+			move(&n.Start_)
+			move(&n.End_)
+		case *ast.Identifier:
+			move(&n.Start_)
+			move(&n.End_)
+		case *ast.UnaryExpr:
+			move(&n.OperatorLocation)
+		case *ast.ParenExpr:
+			move(&n.LparenLocation)
+			move(&n.RparenLocation)
+		case *ast.ListLiteral:
+			move(&n.LbrackLocation)
+			move(&n.RbrackLocation)
+		case *ast.CallExpr:
+			move(&n.RparenLocation)
+		case *ast.PipeExpr:
+			// The location is zero without an argument list.
+			if n.RparenLocation != (ast.Location{}) {
+				move(&n.RparenLocation)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,75 @@
+package parse_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/vietmpl/vie/parse"
+)
+
+var editTests = [...]struct {
+	name string
+	edit parse.Edit
+}{
+	{"insert-text", parse.Edit{Start: 0, End: 0, Text: []byte("hello\n")}},
+	{"edit-display", parse.Edit{Start: 14, End: 15, Text: []byte("name | @upper")}},
+	{"insert-line", parse.Edit{Start: 6, End: 6, Text: []byte("{{ a }}\n")}},
+	{"break-tag", parse.Edit{Start: 11, End: 13, Text: nil}},
+	{"fix-tag", parse.Edit{Start: 11, End: 11, Text: []byte("}}")}},
+	{"open-if", parse.Edit{Start: 0, End: 0, Text: []byte("{% if x %}")}},
+	{"close-if", parse.Edit{Start: 10, End: 10, Text: []byte("{% end %}")}},
+	{"join-delimiter", parse.Edit{Start: 25, End: 25, Text: []byte("{")}},
+	{"split-delimiter", parse.Edit{Start: 25, End: 26, Text: nil}},
+	{"delete-if", parse.Edit{Start: 0, End: 19, Text: nil}},
+	{"append", parse.Edit{Start: 0, End: 0, Text: []byte("{% block a %}{% end %}")}},
+	{"duplicate-block", parse.Edit{Start: 0, End: 0, Text: []byte("{% block a %}{% end %}")}},
+	{"rename-block", parse.Edit{Start: 9, End: 10, Text: []byte("b")}},
+	{"extends", parse.Edit{Start: 22, End: 22, Text: []byte("{% extends \"base\" %}")}},
+}
+
+// TestDocument checks that each edit of a document results in the template
+// parsed from the edited source from scratch.
+func TestDocument(t *testing.T) {
+	t.Parallel()
+
+	source := "text\n{{ x }}\n{% for x in xs %}{{ x }}{% end %}\n"
+	document := parse.Options{}.Document("a.vie", []byte(source))
+	for _, test := range editTests {
+		template, err := document.Edit(test.edit)
+		expected, expectedErr := parse.Options{}.File("a.vie", document.Source())
+		if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+			t.Fatalf("%s: expected error %v, got %v", test.name, expectedErr, err)
+		}
+		if !reflect.DeepEqual(template, expected) {
+			t.Fatalf("%s: the template of %q differs from a full parse", test.name, document.Source())
+		}
+	}
+
+	if _, err := document.Edit(parse.Edit{Start: 1, End: 0}); err == nil {
+		t.Errorf("expected error for an invalid range, got no error")
+	}
+}
+
+func TestDocumentReuse(t *testing.T) {
+	t.Parallel()
+
+	source := "{% if a %}{{ b }}{% end %}\n{{ c }}\n{% set d = 1 %}"
+	document := parse.Options{}.Document("", []byte(source))
+	before, err := document.Template()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := before.Blocks[0], before.Blocks[4]
+
+	after, err := document.Edit(parse.Edit{Start: 30, End: 31, Text: []byte("e + f")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Blocks[0] != first || after.Blocks[4] != last {
+		t.Errorf("expected the blocks around the edit to be reused")
+	}
+	if start := last.Start().Offset; start != 39 {
+		t.Errorf("expected the set block to move to 39, got %d", start)
+	}
+}
@@ -0,0 +1,63 @@
+package parse
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/vietmpl/vie/ast"
+)
+
+// Error is a syntax error at a location in the source.
+type Error struct {
+	// Path is the path of the file containing the error, or empty if the
+	// source does not come from a file.
+	Path     string
+	Location ast.Location
+	Msg      string
+}
+
+// Error returns the message prefixed by the path and the 1-based line and
+// column of the error.
+func (e *Error) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s:%s: %s", e.Path, e.Location, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Location, e.Msg)
+}
+
+// ErrorList is a list of syntax errors, ordered by location once returned
+// by the parser.
+type ErrorList []*Error
+
+// Add appends an error with the message msg at location.
+func (l *ErrorList) Add(path string, location ast.Location, msg string) {
+	*l = append(*l, &Error{Path: path, Location: location, Msg: msg})
+}
+
+// Sort sorts the errors by location.
+func (l ErrorList) Sort() {
+	slices.SortStableFunc(l, func(x, y *Error) int {
+		return cmp.Compare(x.Location.Offset, y.Location.Offset)
+	})
+}
+
+// Error returns the first error followed by the number of the remaining
+// ones.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns l as an error, or nil if l is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
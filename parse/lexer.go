@@ -0,0 +1,306 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vietmpl/vie/token"
+)
+
+// lexer splits the source of a template into tokens. Text is scanned up to
+// the next opening delimiter, and the content of tags is scanned into the
+// tokens of expressions, skipping whitespace.
+type lexer struct {
+	source     string
+	delimiters Delimiters
+	// offset is the offset of the next byte to scan.
+	offset int
+	// close is the closing delimiter of the tag being scanned, or empty
+	// between tags.
+	close string
+	// closed is set if the closing delimiter of the tag being scanned is
+	// in the source. Opening delimiters end unclosed tags only, so that
+	// they can be scanned as operators in other tags.
+	closed bool
+	// comment is set after the opening delimiter of a comment, until its
+	// content is scanned.
+	comment bool
+	// error reports an invalid token at offset.
+	error func(offset int, msg string)
+}
+
+// next scans the next token, returning its kind and the offsets of its
+// start and end. Opening delimiters include a following whitespace control
+// marker and closing delimiters a preceding one.
+func (l *lexer) next() (kind token.Kind, start, end int) {
+	switch {
+	case l.comment:
+		return l.scanComment()
+	case l.close != "":
+		return l.scanTag()
+	default:
+		return l.scanText()
+	}
+}
+
+func (l *lexer) scanText() (token.Kind, int, int) {
+	start := l.offset
+	rest := l.source[start:]
+	if rest == "" {
+		return token.EOF, start, start
+	}
+	d := l.delimiters
+	switch {
+	case strings.HasPrefix(rest, d.DisplayOpen):
+		l.close = d.DisplayClose
+		end := l.scanOpen(d.DisplayOpen)
+		l.closed = l.tagClosed()
+		return token.L_DOUBLE_BRACE, start, end
+	case strings.HasPrefix(rest, d.StatementOpen):
+		l.close = d.StatementClose
+		end := l.scanOpen(d.StatementOpen)
+		l.closed = l.tagClosed()
+		return token.L_BRACE_PERCENT, start, end
+	case strings.HasPrefix(rest, d.CommentOpen):
+		l.close = d.CommentClose
+		l.comment = true
+		return token.L_BRACE_POUND, start, l.scanOpen(d.CommentOpen)
+	}
+	l.offset += l.textEnd(rest)
+	return token.TEXT, start, l.offset
+}
+
+// textEnd returns the length of the text at the start of s, which ends at
+// the first opening delimiter.
+func (l *lexer) textEnd(s string) int {
+	d := l.delimiters
+	end := len(s)
+	for _, open := range [...]string{d.DisplayOpen, d.StatementOpen, d.CommentOpen} {
+		if i := strings.Index(s[:end], open); i >= 0 {
+			end = i
+		}
+	}
+	return end
+}
+
+// opensTag reports whether s starts with an opening delimiter.
+func (l *lexer) opensTag(s string) bool {
+	d := l.delimiters
+	return strings.HasPrefix(s, d.DisplayOpen) ||
+		strings.HasPrefix(s, d.StatementOpen) ||
+		strings.HasPrefix(s, d.CommentOpen)
+}
+
+// scanOpen skips the opening delimiter open and a following whitespace
+// control marker, returning the end of the delimiter.
+func (l *lexer) scanOpen(open string) int {
+	l.offset += len(open)
+	if strings.HasPrefix(l.source[l.offset:], "-") {
+		l.offset++
+	}
+	return l.offset
+}
+
+// tagClosed reports whether the closing delimiter of the tag follows the
+// offset, skipping string literals.
+func (l *lexer) tagClosed() bool {
+	for i := l.offset; i < len(l.source); {
+		switch c := l.source[i]; {
+		case c == '"' || c == '\'' || c == '`':
+			i = stringEnd(l.source, i)
+		case strings.HasPrefix(l.source[i:], l.close):
+			return true
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// scanClose reports whether the closing delimiter of the tag, optionally
+// preceded by a whitespace control marker, is at the offset, and skips it if
+// so.
+func (l *lexer) scanClose() bool {
+	rest := l.source[l.offset:]
+	switch {
+	case strings.HasPrefix(rest, "-"+l.close):
+		l.offset += 1 + len(l.close)
+	case strings.HasPrefix(rest, l.close):
+		l.offset += len(l.close)
+	default:
+		return false
+	}
+	l.close = ""
+	return true
+}
+
+func (l *lexer) scanComment() (token.Kind, int, int) {
+	l.comment = false
+	start := l.offset
+	rest := l.source[start:]
+	end := strings.Index(rest, l.close)
+	if end < 0 {
+		end = len(rest)
+	} else if end > 0 && rest[end-1] == '-' {
+		end--
+	}
+	if end == 0 {
+		// An empty comment has no content.
+		return l.scanTag()
+	}
+	l.offset += end
+	return token.COMMENT, start, l.offset
+}
+
+// raw scans the content of a raw block, which ends at the first
+// {% end %} tag, and returns its offsets.
+func (l *lexer) raw() (start, end int) {
+	start = l.offset
+	d := l.delimiters
+	for i := start; ; {
+		j := strings.Index(l.source[i:], d.StatementOpen)
+		if j < 0 {
+			l.offset = len(l.source)
+			return start, l.offset
+		}
+		i += j
+		tag := l.source[i+len(d.StatementOpen):]
+		tag = strings.TrimPrefix(tag, "-")
+		tag = strings.TrimLeft(tag, whitespace)
+		if rest, ok := strings.CutPrefix(tag, token.KEYWORD_END.String()); ok {
+			rest = strings.TrimLeft(rest, whitespace)
+			rest = strings.TrimPrefix(rest, "-")
+			if strings.HasPrefix(rest, d.StatementClose) {
+				l.offset = i
+				return start, i
+			}
+		}
+		i += len(d.StatementOpen)
+	}
+}
+
+// whitespace holds the characters separating the tokens of a tag.
+const whitespace = " \t\r\n"
+
+func (l *lexer) scanTag() (token.Kind, int, int) {
+	for l.offset < len(l.source) && strings.IndexByte(whitespace, l.source[l.offset]) >= 0 {
+		l.offset++
+	}
+	start := l.offset
+	if start == len(l.source) {
+		return token.EOF, start, start
+	}
+	if !l.closed && l.opensTag(l.source[start:]) {
+		// The tag is not closed, so the text following it is scanned as
+		// usual.
+		l.close = ""
+		return l.scanText()
+	}
+	if close := l.close; l.scanClose() {
+		switch close {
+		case l.delimiters.DisplayClose:
+			return token.R_DOUBLE_BRACE, start, l.offset
+		case l.delimiters.StatementClose:
+			return token.R_BRACE_PERCENT, start, l.offset
+		default:
+			return token.R_BRACE_POUND, start, l.offset
+		}
+	}
+
+	c := l.source[start]
+	switch {
+	case isLetter(c) || c == '@':
+		l.offset++
+		for l.offset < len(l.source) && (isLetter(l.source[l.offset]) || isDigit(l.source[l.offset])) {
+			l.offset++
+		}
+		word := l.source[start:l.offset]
+		if word == token.KEYWORD_NOT.String() {
+			// The keywords of "not in" may be separated by any whitespace.
+			rest := strings.TrimLeft(l.source[l.offset:], whitespace)
+			after, ok := strings.CutPrefix(rest, token.KEYWORD_IN.String())
+			if ok && (after == "" || !isLetter(after[0]) && !isDigit(after[0])) {
+				l.offset = len(l.source) - len(after)
+				return token.NOT_IN, start, l.offset
+			}
+		}
+		return token.Lookup(word), start, l.offset
+	case isDigit(c):
+		for l.offset < len(l.source) && isDigit(l.source[l.offset]) {
+			l.offset++
+		}
+		return token.INT_LITERAL, start, l.offset
+	case c == '"' || c == '\'' || c == '`':
+		l.offset = stringEnd(l.source, start)
+		return token.STRING_LITERAL, start, l.offset
+	}
+
+	// Operators of two characters take precedence over their prefixes.
+	for _, kind := range operators {
+		if op := kind.String(); strings.HasPrefix(l.source[start:], op) {
+			l.offset += len(op)
+			return kind, start, l.offset
+		}
+	}
+	l.offset++
+	l.error(start, fmt.Sprintf("unexpected character %q", c))
+	return token.ERROR, start, l.offset
+}
+
+// stringEnd returns the offset following the string literal starting at
+// the offset start of source. Quoted literals end at a line break if they
+// are not terminated, leaving the error to [token.Unquote].
+func stringEnd(source string, start int) int {
+	quote := source[start]
+	i := start + 1
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == quote:
+			return i + 1
+		case quote == '`':
+		case c == '\n':
+			return i
+		case c == '\\' && i+1 < len(source) && source[i+1] != '\n':
+			i++
+		}
+		i++
+	}
+	return i
+}
+
+// operators holds the kinds of the operator and punctuation tokens, longest
+// first.
+var operators = [...]token.Kind{
+	token.BANG_EQUAL,
+	token.EQUAL_EQUAL,
+	token.LESS_EQUAL,
+	token.GREATER_EQUAL,
+	token.L_PAREN,
+	token.R_PAREN,
+	token.L_BRACKET,
+	token.R_BRACKET,
+	token.COMMA,
+	token.COLON,
+	token.DOT,
+	token.BANG,
+	token.EQUAL,
+	token.PIPE,
+	token.TILDE,
+	token.PLUS,
+	token.MINUS,
+	token.STAR,
+	token.SLASH,
+	token.PERCENT,
+	token.LESS,
+	token.GREATER,
+	token.QUESTION,
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
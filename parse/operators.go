@@ -1,37 +1,44 @@
 package parse
 
 import (
-	"fmt"
-
 	"github.com/vietmpl/vie/token"
 )
 
-var binaryOperators = [...]token.Kind{
-	token.BANG_EQUAL,
-	token.EQUAL_EQUAL,
-	token.TILDE,
-	token.KEYWORD_AND,
-	token.KEYWORD_OR,
-}
+// Precedences of binary operators, from the loosest to the tightest
+// binding. Pipes bind tighter than any binary operator and unary operators
+// bind tighter than pipes.
+const (
+	precedenceLowest = iota + 1
+	precedenceAnd
+	precedenceComparison
+	precedenceConcat
+	precedenceAdditive
+	precedenceMultiplicative
+)
 
-func parseBinaryOperator(s string) token.Kind {
-	for _, kind := range binaryOperators {
-		if kind.String() == s {
-			return kind
-		}
+// precedence returns the precedence of the binary operator kind, or 0 if
+// kind is not a binary operator.
+func precedence(kind token.Kind) int {
+	switch kind {
+	case token.KEYWORD_OR:
+		return precedenceLowest
+	case token.KEYWORD_AND:
+		return precedenceAnd
+	case token.EQUAL_EQUAL, token.BANG_EQUAL,
+		token.LESS, token.LESS_EQUAL, token.GREATER, token.GREATER_EQUAL,
+		token.KEYWORD_IN, token.NOT_IN:
+		return precedenceComparison
+	case token.TILDE:
+		return precedenceConcat
+	case token.PLUS, token.MINUS:
+		return precedenceAdditive
+	case token.STAR, token.SLASH, token.PERCENT:
+		return precedenceMultiplicative
+	default:
+		return 0
 	}
-	panic(fmt.Sprintf("unknown binary operator: %s", s))
 }
 
-var unaryOperators = [...]token.Kind{
-	token.BANG,
-}
-
-func parseUnaryOperator(s string) token.Kind {
-	for _, kind := range unaryOperators {
-		if kind.String() == s {
-			return kind
-		}
-	}
-	panic(fmt.Sprintf("unknown unary operator: %s", s))
+func isUnaryOperator(kind token.Kind) bool {
+	return kind == token.BANG || kind == token.MINUS
 }
@@ -1,356 +1,965 @@
 package parse
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
-	ts "github.com/tree-sitter/go-tree-sitter"
-	"github.com/vietmpl/tree-sitter-vie/bindings/go"
-
 	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/token"
 )
 
-var vieLanguage = ts.NewLanguage(tree_sitter_vie.Language())
-
 type parser struct {
-	*ts.TreeCursor
+	lexer lexer
+
+	// path is the path of the file being parsed, used in errors.
+	path   string
+	source string
+	// lineStarts holds the offsets of the starts of the lines of source.
+	lineStarts []int
+
+	// tok is the current token, spanning from start to end.
+	tok        token.Kind
+	start, end int
+	// prevEnd is the end of the previous token.
+	prevEnd int
+
+	// tagStart is the offset of the opening delimiter of the current tag.
+	tagStart int
+	// tagLeft is set if the opening delimiter of the current tag has a
+	// whitespace control marker.
+	tagLeft bool
+	// tagClose is the kind of the closing delimiter of the current tag.
+	tagClose token.Kind
+	// tagError is set once an error is reported in the current tag, so that
+	// the errors following from it are not reported.
+	tagError bool
+
+	// depth is the number of if, for, switch, named and macro blocks
+	// enclosing the block being parsed.
+	depth int
+	// blockNames holds the names of the named blocks parsed so far.
+	blockNames map[string]bool
+	// macroNames holds the names of the macros parsed so far.
+	macroNames map[string]bool
+	// errors holds the syntax errors found so far.
+	errors ErrorList
+}
 
-	source []byte
+// Options configures how templates are parsed.
+type Options struct {
+	// Delimiters are the delimiters of tags. The zero value selects
+	// [DefaultDelimiters].
+	Delimiters Delimiters
 }
 
 func Source(source []byte) (*ast.Template, error) {
-	tsParser := ts.NewParser()
-	_ = tsParser.SetLanguage(vieLanguage)
-	defer tsParser.Close()
+	return Options{}.Source(source)
+}
 
-	tree := tsParser.Parse(source, nil)
-	defer tree.Close()
+// Source parses a template using the options o.
+func (o Options) Source(source []byte) (*ast.Template, error) {
+	return o.File("", source)
+}
 
-	cursor := tree.Walk()
-	defer cursor.Close()
+// File parses the template source read from the file path using the
+// options o. If the source has syntax errors, File reports all of them as
+// an [ErrorList] ordered by location.
+func (o Options) File(path string, source []byte) (*ast.Template, error) {
+	p := newParser(path, string(source), o.Delimiters.WithDefaults())
+	template := p.parseTemplate()
+	if len(p.errors) > 0 {
+		p.errors.Sort()
+		return nil, p.errors
+	}
+	return template, nil
+}
 
-	p := parser{
-		TreeCursor: cursor,
+func newParser(path, source string, delimiters Delimiters) *parser {
+	p := &parser{
+		path:       path,
+		source:     source,
+		lineStarts: lineStarts(source),
+		blockNames: make(map[string]bool),
+		macroNames: make(map[string]bool),
+	}
+	p.lexer = lexer{
 		source:     source,
+		delimiters: delimiters,
+		error: func(offset int, msg string) {
+			p.tagErrorAt(offset, "%s", msg)
+		},
 	}
+	return p
+}
 
+func (p *parser) parseTemplate() *ast.Template {
 	var template ast.Template
-	if !p.GotoFirstChild() {
-		// the file is empty.
-		return &template, nil
-	}
-	defer p.GotoParent()
+	p.next()
+	template.Blocks, _ = p.parseBody()
+	p.checkExtends(template.Blocks)
+	return &template
+}
 
-	for {
-		block, err := p.parseBlock()
-		if err != nil {
-			return nil, err
+// checkExtends reports the extends blocks among the top-level blocks of a
+// template that are preceded by other tags.
+func (p *parser) checkExtends(blocks []ast.Block) {
+	for i, block := range blocks {
+		if _, ok := block.(*ast.ExtendsBlock); ok && slices.ContainsFunc(blocks[:i], isTag) {
+			p.report(p.errorf(block.Start(), "extends must be the first tag of the template"))
 		}
-		if block != nil {
-			template.Blocks = append(template.Blocks, block)
+	}
+}
+
+// isTag reports whether b is produced by a tag, as opposed to plain text.
+func isTag(b ast.Block) bool {
+	_, ok := b.(*ast.TextBlock)
+	return !ok
+}
+
+// parseBody parses blocks up to a statement tag with one of the keywords
+// stop, such as {% end %}, and returns them with the keyword, leaving the
+// parser on it. Other tags continuing or ending a block are reported as
+// unexpected. At the end of the source, parseBody returns [token.EOF].
+func (p *parser) parseBody(stop ...token.Kind) ([]ast.Block, token.Kind) {
+	var blocks []ast.Block
+	for p.tok != token.EOF {
+		start := p.start
+		var block ast.Block
+		switch p.tok {
+		case token.L_BRACE_POUND:
+			block = p.parseComment()
+		case token.L_DOUBLE_BRACE:
+			block = p.parseDisplay()
+		case token.L_BRACE_PERCENT:
+			p.openTag()
+			if isClause(p.tok) {
+				if slices.Contains(stop, p.tok) {
+					return blocks, p.tok
+				}
+				p.parseUnexpectedTag()
+				continue
+			}
+			block = p.parseStatement()
+		default:
+			block = &ast.TextBlock{Content: p.lit()}
+			p.next()
 		}
-		if !p.GotoNextSibling() {
-			break
+		if block == nil {
+			continue
 		}
+		span := spanOf(block)
+		span.Start_ = p.locationAt(start)
+		span.End_ = p.locationAt(p.prevEnd)
+		blocks = append(blocks, block)
 	}
-	return &template, nil
+	return blocks, token.EOF
 }
 
-func (p *parser) parseBlock() (ast.Block, error) {
-	n := p.Node()
-	if n.IsError() {
-		return nil, fmt.Errorf("invalid block")
+// isClause reports whether the statement keyword kind continues or ends a
+// block, as else and end do.
+func isClause(kind token.Kind) bool {
+	switch kind {
+	case token.KEYWORD_ELSEIF, token.KEYWORD_ELSE, token.KEYWORD_CASE,
+		token.KEYWORD_DEFAULT, token.KEYWORD_END:
+		return true
+	default:
+		return false
 	}
-	// TODO(skewb1k): use KindId instead of string comparisons.
-	switch n.Kind() {
-	case "text":
-		return &ast.TextBlock{
-			Content: n.Utf8Text(p.source),
-		}, nil
+}
 
-	case "comment_tag":
-		var comment ast.CommentBlock
-		p.GotoFirstChild()
-		defer p.GotoParent()
+// spanOf returns the span of the block b.
+func spanOf(b ast.Block) *ast.Span {
+	switch block := b.(type) {
+	case *ast.TextBlock:
+		return &block.Span
+	case *ast.CommentBlock:
+		return &block.Span
+	case *ast.RawBlock:
+		return &block.Span
+	case *ast.DisplayBlock:
+		return &block.Span
+	case *ast.IfBlock:
+		return &block.Span
+	case *ast.SwitchBlock:
+		return &block.Span
+	case *ast.ForBlock:
+		return &block.Span
+	case *ast.IncludeBlock:
+		return &block.Span
+	case *ast.ExtendsBlock:
+		return &block.Span
+	case *ast.NamedBlock:
+		return &block.Span
+	case *ast.MacroBlock:
+		return &block.Span
+	case *ast.SetBlock:
+		return &block.Span
+	case *ast.ImportBlock:
+		return &block.Span
+	default:
+		panic(fmt.Sprintf("parser: unexpected block type %T", b))
+	}
+}
 
-		p.GotoNextSibling() // '{#'
-		// handle `{##}`
-		commentNode := p.Node()
-		if commentNode.IsError() {
-			return nil, fmt.Errorf("comments cannot contain line breaks")
-		}
-		if commentNode.Kind() == "comment" {
-			comment.Content = p.Node().Utf8Text(p.source)
+// Tags
+
+// openTag skips the opening delimiter of a tag.
+func (p *parser) openTag() {
+	p.tagStart = p.start
+	p.tagLeft = strings.HasSuffix(p.lit(), "-")
+	switch p.tok {
+	case token.L_DOUBLE_BRACE:
+		p.tagClose = token.R_DOUBLE_BRACE
+	case token.L_BRACE_PERCENT:
+		p.tagClose = token.R_BRACE_PERCENT
+	default:
+		p.tagClose = token.R_BRACE_POUND
+	}
+	p.tagError = false
+	p.next()
+}
+
+// skipTag skips to the closing delimiter of the current tag, reporting the
+// tokens preceding it, and returns the whitespace control markers of the
+// tag. The parser is left on the closing delimiter, or on the token ending
+// an unclosed tag.
+func (p *parser) skipTag() ast.Trim {
+	if p.tok != p.tagClose {
+		p.tagErrorf("expected %s, found %s", p.closeDelimiter(), p.found())
+		for p.tok != p.tagClose && p.tok != token.EOF && !isOpen(p.tok) {
+			p.next()
 		}
-		return &comment, nil
+	}
+	return ast.Trim{
+		Left:  p.tagLeft,
+		Right: p.tok == p.tagClose && strings.HasPrefix(p.lit(), "-"),
+	}
+}
 
-	case "display_tag":
-		var displayBlock ast.DisplayBlock
-		p.GotoFirstChild()
-		defer p.GotoParent()
+// closeTag is like [parser.skipTag], but also skips the closing delimiter.
+func (p *parser) closeTag() ast.Trim {
+	trim := p.skipTag()
+	if p.tok == p.tagClose {
+		p.next()
+	}
+	return trim
+}
 
-		p.GotoNextSibling() // '{{'
-		value, err := p.parseExpr()
-		if err != nil {
-			return nil, err
-		}
-		displayBlock.Value = value
-		p.GotoNextSibling() // '<expr>'
-		// handle `{{ "" "" }}`
-		nn := p.Node()
-		if nn.IsError() {
-			return nil, fmt.Errorf("unexpected %s in display statement", nn.Utf8Text(p.source))
-		}
-		return &displayBlock, nil
+// parseUnexpectedTag reports and skips a tag continuing or ending a block
+// outside of it, such as a stray {% end %}.
+func (p *parser) parseUnexpectedTag() {
+	start := p.tagStart
+	// The whole tag is reported.
+	p.tagError = true
+	p.skipTag()
+	end := p.prevEnd
+	if p.tok == p.tagClose {
+		end = p.end
+		p.next()
+	}
+	tag := strings.TrimSpace(p.source[start:end])
+	p.report(p.errorf(p.locationAt(start), "unexpected %s", tag))
+}
+
+// closeDelimiter returns the closing delimiter of the current tag.
+func (p *parser) closeDelimiter() string {
+	d := p.lexer.delimiters
+	switch p.tagClose {
+	case token.R_DOUBLE_BRACE:
+		return d.DisplayClose
+	case token.R_BRACE_PERCENT:
+		return d.StatementClose
+	default:
+		return d.CommentClose
+	}
+}
+
+// endTag returns the {% end %} tag written with the configured delimiters.
+func (p *parser) endTag() string {
+	d := p.lexer.delimiters
+	return d.StatementOpen + " end " + d.StatementClose
+}
+
+func isOpen(kind token.Kind) bool {
+	return kind == token.L_DOUBLE_BRACE || kind == token.L_BRACE_PERCENT || kind == token.L_BRACE_POUND
+}
+
+func (p *parser) parseComment() ast.Block {
+	var comment ast.CommentBlock
+	p.openTag()
+	// handle `{##}`
+	if p.tok == token.COMMENT {
+		comment.Content = p.lit()
+		p.next()
+	}
+	comment.Trim = p.closeTag()
+	return &comment
+}
 
-	case "if_tag":
-		var ifBlock ast.IfBlock
-		p.GotoFirstChild()
+func (p *parser) parseDisplay() ast.Block {
+	var display ast.DisplayBlock
+	p.openTag()
+	display.Value = p.parseExpr()
+	// handle `{{ "" "" }}`
+	if p.tok != p.tagClose && p.tok != token.EOF && !isOpen(p.tok) {
+		p.tagErrorf("unexpected %s in display statement", p.lit())
+	}
+	display.Trim = p.closeTag()
+	return &display
+}
 
-		p.GotoNextSibling() // '{%'
-		p.GotoNextSibling() // 'if'
-		condition, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+// parseStatement parses a statement tag and the block it starts, leaving
+// the parser after the tag ending the block. The parser is on the keyword
+// of the tag. Invalid tags are skipped, and parseStatement returns nil.
+func (p *parser) parseStatement() ast.Block {
+	switch p.tok {
+	case token.KEYWORD_RAW:
+		return p.parseRaw()
+	case token.KEYWORD_IF:
+		return p.parseIf()
+	case token.KEYWORD_FOR:
+		return p.parseFor()
+	case token.KEYWORD_SWITCH:
+		return p.parseSwitch()
+	case token.KEYWORD_INCLUDE:
+		var include ast.IncludeBlock
+		include.Path = p.parsePathTag()
+		include.Trim = p.closeTag()
+		return &include
+	case token.KEYWORD_EXTENDS:
+		if p.depth > 0 {
+			p.report(p.errorf(p.locationAt(p.tagStart), "extends must be at the top level of the template"))
 		}
-		ifBlock.Branches = append(ifBlock.Branches, ast.IfBranch{
-			Condition: condition,
-		})
-		p.GotoParent()
-
-		for p.GotoNextSibling() {
-			switch p.Node().Kind() {
-			case "elseif_tag":
-				var elseIf ast.IfBranch
-				p.GotoFirstChild()
-
-				p.GotoNextSibling() // '{%'
-				p.GotoNextSibling() // 'elseif'
-				condition, err := p.parseExpr()
-				if err != nil {
-					return nil, err
-				}
-				elseIf.Condition = condition
-				p.GotoParent()
-
-				for p.GotoNextSibling() {
-					kind := p.Node().Kind()
-					if kind == "elseif_tag" || kind == "else_tag" || kind == "end_tag" {
-						p.GotoPreviousSibling()
-						break
-					}
-					block, err := p.parseBlock()
-					if err != nil {
-						return nil, err
-					}
-					if block != nil {
-						elseIf.Consequence = append(elseIf.Consequence, block)
-					}
-				}
-				ifBlock.Branches = append(ifBlock.Branches, elseIf)
+		var extends ast.ExtendsBlock
+		extends.Path = p.parsePathTag()
+		extends.Trim = p.closeTag()
+		return &extends
+	case token.KEYWORD_IMPORT:
+		var importBlock ast.ImportBlock
+		importBlock.Path = p.parsePathTag()
+		importBlock.Trim = p.closeTag()
+		return &importBlock
+	case token.KEYWORD_BLOCK:
+		return p.parseNamedBlock()
+	case token.KEYWORD_SET:
+		return p.parseSet()
+	case token.KEYWORD_MACRO:
+		return p.parseMacro()
+	default:
+		p.tagErrorf("expected statement, found %s", p.found())
+		p.closeTag()
+		return nil
+	}
+}
 
-			case "else_tag":
-				p.GotoFirstChild()
+func (p *parser) parseRaw() ast.Block {
+	var raw ast.RawBlock
+	start := p.tagStart
+	p.next() // 'raw'
+	raw.Trim = p.skipTag()
+	if p.tok != p.tagClose {
+		return &raw
+	}
+	// The content of a raw block is scanned up to its end tag, so tags
+	// inside it are never parsed.
+	contentStart, contentEnd := p.lexer.raw()
+	raw.Content = p.source[contentStart:contentEnd]
+	p.next()
+	if p.tok == token.EOF {
+		p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+		return &raw
+	}
+	p.openTag()
+	p.next() // 'end'
+	raw.EndTrim = p.closeTag()
+	return &raw
+}
 
-				p.GotoNextSibling() // '{%'
-				p.GotoNextSibling() // 'else'
-				// handle `{% else "" %}`
-				nn := p.Node()
-				if nn.IsError() {
-					content := nn.Utf8Text(p.source)
-					return nil, fmt.Errorf("unexpected %q after else", content)
-				}
-				p.GotoParent()
+func (p *parser) parseIf() ast.Block {
+	p.depth++
+	defer func() { p.depth-- }()
+	var ifBlock ast.IfBlock
+	start := p.tagStart
 
-				ifBlock.Alternative = &[]ast.Block{}
-				for p.GotoNextSibling() {
-					if p.Node().Kind() == "end_tag" {
-						p.GotoPreviousSibling()
-						break
-					}
-					block, err := p.parseBlock()
-					if err != nil {
-						return nil, err
-					}
-					if block != nil {
-						*ifBlock.Alternative = append(*ifBlock.Alternative, block)
-					}
-				}
+	p.next() // 'if'
+	condition := p.parseExpr()
+	ifBlock.Branches = append(ifBlock.Branches, ast.IfBranch{
+		Condition: condition,
+		Trim:      p.closeTag(),
+	})
 
-			case "end_tag":
-				return &ifBlock, nil
+	for {
+		body, stop := p.parseBody(token.KEYWORD_ELSEIF, token.KEYWORD_ELSE, token.KEYWORD_END)
+		if ifBlock.Alternative != nil {
+			*ifBlock.Alternative = append(*ifBlock.Alternative, body...)
+		} else {
+			last := &ifBlock.Branches[len(ifBlock.Branches)-1]
+			last.Consequence = append(last.Consequence, body...)
+		}
 
-			default:
-				block, err := p.parseBlock()
-				if err != nil {
-					return nil, err
-				}
-				if block != nil {
-					ifBlock.Branches[0].Consequence = append(ifBlock.Branches[0].Consequence, block)
-				}
+		switch stop {
+		case token.KEYWORD_ELSEIF:
+			if ifBlock.Alternative != nil {
+				p.tagErrorAt(p.tagStart, "unexpected elseif after else")
+			}
+			p.next() // 'elseif'
+			condition := p.parseExpr()
+			elseIf := ast.IfBranch{
+				Condition: condition,
+				Trim:      p.closeTag(),
+			}
+			if ifBlock.Alternative == nil {
+				ifBlock.Branches = append(ifBlock.Branches, elseIf)
 			}
-		}
 
-		return nil, fmt.Errorf("expected {%% end %%}, found EOF")
+		case token.KEYWORD_ELSE:
+			if ifBlock.Alternative != nil {
+				p.tagErrorAt(p.tagStart, "unexpected else")
+			}
+			ifBlock.ElseTrim = p.parseElseTag()
+			if ifBlock.Alternative == nil {
+				ifBlock.Alternative = &[]ast.Block{}
+			}
 
-	case "end_tag", "elseif_tag", "else_tag":
-		return nil, fmt.Errorf("unexpected %s", strings.TrimSpace(n.Utf8Text(p.source)))
+		case token.KEYWORD_END:
+			p.next() // 'end'
+			ifBlock.EndTrim = p.closeTag()
+			return &ifBlock
 
-	default:
-		panic(fmt.Sprintf("parser: unexpected block kind %q while parsing %s", n.Kind(), p.source))
-	}
-}
-
-func (p *parser) parseExpr() (ast.Expr, error) {
-	n := p.Node()
-	if n.IsError() || n.IsMissing() {
-		return nil, fmt.Errorf("expected expression, found %s", n.Utf8Text(p.source))
-	}
-	switch n.Kind() {
-	case "string_literal":
-		return &ast.BasicLiteral{
-			Start_: posFromTsPoint(n.StartPosition()),
-			Kind:   ast.KindString,
-			Value:  n.Utf8Text(p.source),
-		}, nil
-
-	case "boolean_literal":
-		return &ast.BasicLiteral{
-			Start_: posFromTsPoint(n.StartPosition()),
-			Kind:   ast.KindBool,
-			Value:  n.Utf8Text(p.source),
-		}, nil
-
-	case "identifier":
-		return &ast.Identifier{
-			Start_: posFromTsPoint(n.StartPosition()),
-			Value:  n.Utf8Text(p.source),
-		}, nil
-
-	case "unary_expression":
-		p.GotoFirstChild()
-		defer p.GotoParent()
-		var unary ast.UnaryExpr
-
-		nn := p.Node()
-		unary.OperatorLocation = posFromTsPoint(nn.StartPosition())
-		unary.Operator = parseUnaryOperator(nn.Utf8Text(p.source))
-
-		p.GotoNextSibling()
-		operand, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+		default:
+			p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+			return &ifBlock
 		}
-		unary.Operand = operand
-		return &unary, nil
+	}
+}
+
+// parseElseTag parses an else tag, reporting content following the
+// keyword, as in {% else "" %}.
+func (p *parser) parseElseTag() ast.Trim {
+	p.next() // 'else'
+	if p.tok != p.tagClose && p.tok != token.EOF && !isOpen(p.tok) {
+		p.tagErrorf("unexpected %q after else", p.lit())
+	}
+	return p.closeTag()
+}
 
-	case "binary_expression":
-		p.GotoFirstChild()
-		defer p.GotoParent()
-		var binary ast.BinaryExpr
+func (p *parser) parseFor() ast.Block {
+	p.depth++
+	defer func() { p.depth-- }()
+	var forBlock ast.ForBlock
+	start := p.tagStart
+
+	p.next() // 'for'
+	if p.tok == token.IDENTIFIER {
+		forBlock.Variable = p.parseIdent()
+		p.expect(token.KEYWORD_IN)
+		forBlock.Iterable = p.parseExpr()
+	} else {
+		p.tagErrorf("expected loop variable, found %s", p.found())
+	}
+	forBlock.Trim = p.closeTag()
 
-		lOperand, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+	for {
+		body, stop := p.parseBody(token.KEYWORD_ELSE, token.KEYWORD_END)
+		if forBlock.Alternative != nil {
+			*forBlock.Alternative = append(*forBlock.Alternative, body...)
+		} else {
+			forBlock.Body = append(forBlock.Body, body...)
 		}
-		binary.LOperand = lOperand
 
-		p.GotoNextSibling()
-		binary.Operator = parseBinaryOperator(p.Node().Utf8Text(p.source))
+		switch stop {
+		case token.KEYWORD_ELSE:
+			if forBlock.Alternative != nil {
+				p.tagErrorAt(p.tagStart, "unexpected else")
+			}
+			forBlock.ElseTrim = p.parseElseTag()
+			if forBlock.Alternative == nil {
+				forBlock.Alternative = &[]ast.Block{}
+			}
+
+		case token.KEYWORD_END:
+			p.next() // 'end'
+			forBlock.EndTrim = p.closeTag()
+			return &forBlock
 
-		p.GotoNextSibling()
-		rOperand, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+		default:
+			p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+			return &forBlock
 		}
-		binary.ROperand = rOperand
+	}
+}
 
-		return &binary, nil
+func (p *parser) parseSwitch() ast.Block {
+	p.depth++
+	defer func() { p.depth-- }()
+	var switchBlock ast.SwitchBlock
+	start := p.tagStart
+
+	p.next() // 'switch'
+	switchBlock.Value = p.parseExpr()
+	switchBlock.Trim = p.closeTag()
+
+	// Only whitespace may precede the first case.
+	body, stop := p.parseBody(token.KEYWORD_CASE, token.KEYWORD_DEFAULT, token.KEYWORD_END)
+	for _, block := range body {
+		content := strings.TrimSpace(p.source[block.Start().Offset:block.End().Offset])
+		text, ok := block.(*ast.TextBlock)
+		if !ok || content != "" {
+			p.report(p.errorf(block.Start(), "expected case, found %s", content))
+			break
+		}
+		switchBlock.Space += text.Content
+	}
 
-	case "call_expression":
-		p.GotoFirstChild()
-		defer p.GotoParent()
-		var call ast.CallExpr
+	for {
+		switch stop {
+		case token.KEYWORD_CASE:
+			if switchBlock.Default != nil {
+				p.tagErrorAt(p.tagStart, "unexpected case after default")
+			}
+			switchBlock.Cases = append(switchBlock.Cases, p.parseCaseTag())
 
-		nn := p.Node()
-		call.Function = ast.Identifier{
-			Start_: posFromTsPoint(nn.StartPosition()),
-			Value:  nn.Utf8Text(p.source),
+		case token.KEYWORD_DEFAULT:
+			if switchBlock.Default != nil {
+				p.tagErrorAt(p.tagStart, "unexpected default")
+			}
+			p.next() // 'default'
+			switchBlock.DefaultTrim = p.closeTag()
+			if switchBlock.Default == nil {
+				switchBlock.Default = &[]ast.Block{}
+			}
+
+		case token.KEYWORD_END:
+			p.next() // 'end'
+			switchBlock.EndTrim = p.closeTag()
+			return &switchBlock
+
+		default:
+			p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+			return &switchBlock
 		}
-		p.GotoNextSibling()
-		arguments, err := p.parseExprList()
-		if err != nil {
-			return nil, err
+
+		body, stop = p.parseBody(token.KEYWORD_CASE, token.KEYWORD_DEFAULT, token.KEYWORD_END)
+		switch {
+		case switchBlock.Default != nil:
+			*switchBlock.Default = append(*switchBlock.Default, body...)
+		case len(switchBlock.Cases) > 0:
+			last := &switchBlock.Cases[len(switchBlock.Cases)-1]
+			last.Body = append(last.Body, body...)
 		}
-		call.Arguments = arguments
+	}
+}
+
+// parseCaseTag parses a case tag with its comma-separated values.
+func (p *parser) parseCaseTag() ast.SwitchCase {
+	var switchCase ast.SwitchCase
+	p.next() // 'case'
+	if p.tok == p.tagClose {
+		p.tagErrorAt(p.tagStart, "expected case value")
+	} else {
+		switchCase.Values = p.parseExprList()
+	}
+	switchCase.Trim = p.closeTag()
+	return switchCase
+}
 
-		return &call, nil
+// parsePathTag parses the string literal following the keyword of a tag
+// such as {% include "path" %}.
+func (p *parser) parsePathTag() ast.BasicLiteral {
+	keyword := p.tok
+	p.next()
+	if p.tok != token.STRING_LITERAL {
+		p.tagErrorf("expected string literal after %s, found %s", keyword, p.found())
+		return ast.BasicLiteral{}
+	}
+	return *p.parseStringLiteral()
+}
 
-	case "pipe_expression":
-		p.GotoFirstChild()
-		defer p.GotoParent()
-		var pipe ast.PipeExpr
+func (p *parser) parseNamedBlock() ast.Block {
+	var namedBlock ast.NamedBlock
+	start := p.tagStart
 
-		argument, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+	p.next() // 'block'
+	if p.tok == token.IDENTIFIER {
+		namedBlock.Name = p.parseIdent()
+		if p.blockNames[namedBlock.Name.Value] {
+			p.report(p.errorf(namedBlock.Name.Start_, "block %s is already defined", namedBlock.Name.Value))
 		}
-		pipe.Argument = argument
-		p.GotoNextSibling() // <expr>
+		p.blockNames[namedBlock.Name.Value] = true
+	} else {
+		p.tagErrorf("expected block name, found %s", p.found())
+	}
+	namedBlock.Trim = p.closeTag()
+
+	p.depth++
+	defer func() { p.depth-- }()
+	body, stop := p.parseBody(token.KEYWORD_END)
+	namedBlock.Body = body
+	if stop != token.KEYWORD_END {
+		p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+		return &namedBlock
+	}
+	p.next() // 'end'
+	namedBlock.EndTrim = p.closeTag()
+	return &namedBlock
+}
+
+func (p *parser) parseSet() ast.Block {
+	var set ast.SetBlock
+	p.next() // 'set'
+	if p.tok == token.IDENTIFIER {
+		set.Name = p.parseIdent()
+		p.expect(token.EQUAL)
+		set.Value = p.parseExpr()
+	} else {
+		p.tagErrorf("expected variable name after set, found %s", p.found())
+	}
+	set.Trim = p.closeTag()
+	return &set
+}
 
-		p.GotoNextSibling() // '|'
+func (p *parser) parseMacro() ast.Block {
+	var macro ast.MacroBlock
+	start := p.tagStart
+	if p.depth > 0 {
+		p.report(p.errorf(p.locationAt(start), "macros must be defined at the top level of the template"))
+	}
 
-		nn := p.Node()
-		if nn.IsError() || nn.IsMissing() {
-			return nil, fmt.Errorf("expected expression, found %s", n.Utf8Text(p.source))
+	p.next() // 'macro'
+	if p.tok == token.IDENTIFIER {
+		macro.Name = p.parseIdent()
+		switch {
+		case strings.HasPrefix(macro.Name.Value, "@"):
+			p.report(p.errorf(macro.Name.Start_, "macro name %s cannot start with @", macro.Name.Value))
+		case p.macroNames[macro.Name.Value]:
+			p.report(p.errorf(macro.Name.Start_, "macro %s is already defined", macro.Name.Value))
 		}
-		pipe.Function = ast.Identifier{Value: nn.Utf8Text(p.source)}
+		p.macroNames[macro.Name.Value] = true
+		macro.Parameters = p.parseParameterList()
+	} else {
+		p.tagErrorf("expected macro name, found %s", p.found())
+	}
+	macro.Trim = p.closeTag()
+
+	p.depth++
+	defer func() { p.depth-- }()
+	body, stop := p.parseBody(token.KEYWORD_END)
+	macro.Body = body
+	if stop != token.KEYWORD_END {
+		p.report(p.errorf(p.locationAt(start), "expected %s, found EOF", p.endTag()))
+		return &macro
+	}
+	p.next() // 'end'
+	macro.EndTrim = p.closeTag()
+	return &macro
+}
 
-		return &pipe, nil
+// parseParameterList parses the parenthesized parameters of a macro.
+func (p *parser) parseParameterList() []ast.Identifier {
+	if p.tok != token.L_PAREN {
+		p.tagErrorf("expected parameter list, found %s", p.found())
+		return nil
+	}
+	p.next() // '('
+	var parameters []ast.Identifier
+	for p.tok != token.R_PAREN {
+		if len(parameters) > 0 && !p.expect(token.COMMA) {
+			return parameters
+		}
+		if p.tok != token.IDENTIFIER {
+			p.tagErrorf("expected parameter name, found %s", p.found())
+			return parameters
+		}
+		parameter := p.parseIdent()
+		for _, prev := range parameters {
+			if prev.Value == parameter.Value {
+				p.report(p.errorf(parameter.Start_, "duplicate parameter %s", parameter.Value))
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	p.next() // ')'
+	return parameters
+}
 
-	case "parenthesized_expression":
-		p.GotoFirstChild()
-		defer p.GotoParent()
-		var paren ast.ParenExpr
+// Expressions
 
-		paren.LparenLocation = posFromTsPoint(p.Node().StartPosition())
-		p.GotoNextSibling()
+func (p *parser) parseExpr() ast.Expr {
+	condition := p.parseBinaryExpr(precedenceLowest)
+	if p.tok != token.QUESTION {
+		return condition
+	}
+	var conditional ast.ConditionalExpr
+	conditional.Condition = condition
+	p.next() // '?'
+	conditional.Consequence = p.parseExpr()
+	p.expect(token.COLON)
+	conditional.Alternative = p.parseExpr()
+	return &conditional
+}
 
-		value, err := p.parseExpr()
-		if err != nil {
-			return nil, err
+// parseBinaryExpr parses a binary expression whose operators have at least
+// the precedence prec. Binary operators are left-associative.
+func (p *parser) parseBinaryExpr(prec int) ast.Expr {
+	x := p.parsePipeExpr()
+	for {
+		operator := p.tok
+		operatorPrec := precedence(operator)
+		if operatorPrec == 0 || operatorPrec < prec {
+			return x
 		}
-		paren.Value = value
-		return &paren, nil
+		p.next()
+		binary := ast.BinaryExpr{
+			LOperand: x,
+			Operator: operator,
+			ROperand: p.parseBinaryExpr(operatorPrec + 1),
+		}
+		x = &binary
+	}
+}
 
-	default:
-		return nil, fmt.Errorf("expected expression, found %s", n.Utf8Text(p.source))
+func (p *parser) parsePipeExpr() ast.Expr {
+	x := p.parseUnaryExpr()
+	for p.tok == token.PIPE {
+		pipe := ast.PipeExpr{Argument: x}
+		p.next() // '|'
+		if p.tok != token.IDENTIFIER {
+			p.tagErrorf("expected function name, found %s", p.found())
+			return &pipe
+		}
+		pipe.Function = p.parseIdent()
+		if p.tok == token.L_PAREN {
+			// The piped value is followed by the arguments of the call.
+			pipe.Arguments, pipe.RparenLocation = p.parseArguments()
+		}
+		x = &pipe
 	}
+	return x
 }
 
-func (p *parser) parseExprList() ([]ast.Expr, error) {
-	p.GotoFirstChild()
-	defer p.GotoParent()
+func (p *parser) parseUnaryExpr() ast.Expr {
+	if !isUnaryOperator(p.tok) {
+		return p.parsePrimaryExpr()
+	}
+	var unary ast.UnaryExpr
+	unary.OperatorLocation = p.locationAt(p.start)
+	unary.Operator = p.tok
+	p.next()
+	unary.Operand = p.parseUnaryExpr()
+	return &unary
+}
 
-	var list []ast.Expr
-	for {
-		if p.Node().IsNamed() {
-			expr, err := p.parseExpr()
-			if err != nil {
-				return nil, err
+func (p *parser) parsePrimaryExpr() ast.Expr {
+	x := p.parseOperand()
+	for x != nil && p.tok == token.DOT {
+		member := ast.MemberExpr{Object: x}
+		p.next() // '.'
+		if p.tok != token.IDENTIFIER {
+			p.tagErrorf("expected field name, found %s", p.found())
+			return &member
+		}
+		member.Member = p.parseIdent()
+		x = &member
+	}
+	return x
+}
+
+// parseOperand parses a literal, an identifier, a call or a parenthesized
+// expression. If there is none, parseOperand reports it and returns nil.
+func (p *parser) parseOperand() ast.Expr {
+	switch p.tok {
+	case token.IDENTIFIER:
+		if value := p.lit(); value == "true" || value == "false" {
+			lit := &ast.BasicLiteral{
+				Start_: p.locationAt(p.start),
+				End_:   p.locationAt(p.end),
+				Kind:   ast.KindBool,
+				Value:  value,
 			}
-			list = append(list, expr)
+			p.next()
+			return lit
 		}
-		if !p.GotoNextSibling() {
-			break
+		ident := p.parseIdent()
+		if p.tok != token.L_PAREN {
+			return &ident
 		}
+		call := ast.CallExpr{Function: ident}
+		call.Arguments, call.RparenLocation = p.parseArguments()
+		return &call
+
+	case token.INT_LITERAL:
+		lit := &ast.BasicLiteral{
+			Start_: p.locationAt(p.start),
+			End_:   p.locationAt(p.end),
+			Kind:   ast.KindInt,
+			Value:  p.lit(),
+		}
+		if _, err := strconv.ParseInt(lit.Value, 10, 64); err != nil {
+			p.tagErrorf("invalid integer literal %s: out of range", lit.Value)
+		}
+		p.next()
+		return lit
+
+	case token.STRING_LITERAL:
+		return p.parseStringLiteral()
+
+	case token.L_PAREN:
+		var paren ast.ParenExpr
+		paren.LparenLocation = p.locationAt(p.start)
+		p.next() // '('
+		paren.Value = p.parseExpr()
+		paren.RparenLocation = p.locationAt(p.start)
+		p.expect(token.R_PAREN)
+		return &paren
+
+	case token.L_BRACKET:
+		var list ast.ListLiteral
+		list.LbrackLocation = p.locationAt(p.start)
+		p.next() // '['
+		if p.tok != token.R_BRACKET {
+			list.Elements = p.parseExprList()
+		}
+		list.RbrackLocation = p.locationAt(p.start)
+		p.expect(token.R_BRACKET)
+		return &list
+
+	default:
+		p.tagErrorf("expected expression, found %s", p.found())
+		return nil
+	}
+}
+
+// parseArguments parses the parenthesized arguments of a call and returns
+// them with the location of the closing parenthesis.
+func (p *parser) parseArguments() ([]ast.Expr, ast.Location) {
+	p.next() // '('
+	var arguments []ast.Expr
+	if p.tok != token.R_PAREN {
+		arguments = p.parseExprList()
+	}
+	rparen := p.locationAt(p.start)
+	p.expect(token.R_PAREN)
+	return arguments, rparen
+}
+
+func (p *parser) parseExprList() []ast.Expr {
+	list := []ast.Expr{p.parseExpr()}
+	for p.tok == token.COMMA {
+		p.next() // ','
+		list = append(list, p.parseExpr())
+	}
+	return list
+}
+
+func (p *parser) parseIdent() ast.Identifier {
+	ident := ast.Identifier{
+		Start_: p.locationAt(p.start),
+		End_:   p.locationAt(p.end),
+		Value:  p.lit(),
+	}
+	p.next()
+	return ident
+}
+
+// parseStringLiteral parses a string literal, reporting invalid escape
+// sequences at their location.
+func (p *parser) parseStringLiteral() *ast.BasicLiteral {
+	lit := &ast.BasicLiteral{
+		Start_: p.locationAt(p.start),
+		End_:   p.locationAt(p.end),
+		Kind:   ast.KindString,
+		Value:  p.lit(),
+	}
+	if _, err := token.Unquote(lit.Value); err != nil {
+		var litErr *token.LiteralError
+		errors.As(err, &litErr)
+		p.tagErrorAt(p.start+litErr.Offset, "%s", litErr.Msg)
+	}
+	p.next()
+	return lit
+}
+
+// Tokens
+
+// next advances to the next token.
+func (p *parser) next() {
+	p.prevEnd = p.end
+	p.tok, p.start, p.end = p.lexer.next()
+}
+
+// lit returns the text of the current token.
+func (p *parser) lit() string {
+	return p.source[p.start:p.end]
+}
+
+// found describes the current token in errors.
+func (p *parser) found() string {
+	if p.tok == token.EOF {
+		return "EOF"
 	}
-	return list, nil
+	return p.lit()
+}
+
+// expect skips the current token if it is of the kind, and reports it
+// otherwise.
+func (p *parser) expect(kind token.Kind) bool {
+	if p.tok != kind {
+		p.tagErrorf("expected %s, found %s", kind, p.found())
+		return false
+	}
+	p.next()
+	return true
+}
+
+// Errors
+
+// errorf returns a syntax error at location.
+func (p *parser) errorf(location ast.Location, format string, args ...any) *Error {
+	return &Error{Path: p.path, Location: location, Msg: fmt.Sprintf(format, args...)}
 }
 
-func posFromTsPoint(point ts.Point) ast.Location {
+// report records err to be returned with the other errors of the template.
+func (p *parser) report(err *Error) {
+	p.errors = append(p.errors, err)
+}
+
+// tagErrorf reports an error at the current token, unless one was already
+// reported in the current tag.
+func (p *parser) tagErrorf(format string, args ...any) {
+	p.tagErrorAt(p.start, format, args...)
+}
+
+// tagErrorAt reports an error at the byte offset, unless one was already
+// reported in the current tag.
+func (p *parser) tagErrorAt(offset int, format string, args ...any) {
+	if p.tagError {
+		return
+	}
+	p.tagError = true
+	p.report(p.errorf(p.locationAt(offset), format, args...))
+}
+
+// locationAt returns the location of the byte offset in the source.
+func (p *parser) locationAt(offset int) ast.Location {
+	// The number of lines starting at or before offset.
+	line, _ := slices.BinarySearch(p.lineStarts, offset+1)
 	return ast.Location{
-		Line:   point.Row,
-		Column: point.Column,
+		Line:   uint(line - 1),
+		Column: uint(offset - p.lineStarts[line-1]),
+		Offset: uint(offset),
+	}
+}
+
+// lineStarts returns the offsets of the starts of the lines of source.
+func lineStarts(source string) []int {
+	starts := []int{0}
+	for i := range len(source) {
+		if source[i] == '\n' {
+			starts = append(starts, i+1)
+		}
 	}
+	return starts
 }
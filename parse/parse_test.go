@@ -1,9 +1,11 @@
 package parse_test
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 
+	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/parse"
 )
 
@@ -62,6 +64,142 @@ var errorTests = [...]struct {
 	{
 		"multiline-display", "{{ \n }}",
 	},
+	{
+		"unclosed-list-literal",
+		"{{ [\"a\" }}",
+	},
+	{
+		"missing-list-element",
+		"{{ [\"a\", , \"b\"] }}",
+	},
+	{
+		"missing-member",
+		"{{ entity. }}",
+	},
+	{
+		"missing-member-object",
+		"{{ .name }}",
+	},
+	{
+		"unknown-escape-sequence",
+		"{{ \"a\\qb\" }}",
+	},
+	{
+		"invalid-unicode-escape",
+		"{{ 'a\\u12' }}",
+	},
+	{
+		"invalid-include-path-escape",
+		"{% include \"\\x\" %}",
+	},
+	{
+		"integer-out-of-range",
+		"{{ 9223372036854775808 }}",
+	},
+	{
+		"missing-right-operand",
+		"{{ 1 + }}",
+	},
+	{
+		"missing-not-in-operand",
+		"{{ a not in }}",
+	},
+	{
+		"missing-conditional-alternative",
+		"{{ a ? b }}",
+	},
+	{
+		"missing-switch-end",
+		"{% switch a %}{% case 1 %}",
+	},
+	{
+		"missing-case-value",
+		"{% switch a %}{% case %}{% end %}",
+	},
+	{
+		"text-before-case",
+		"{% switch a %}x{% case 1 %}{% end %}",
+	},
+	{
+		"case-after-default",
+		"{% switch a %}{% default %}{% case 1 %}{% end %}",
+	},
+	{
+		"missing-for-end",
+		"{% for x in xs %}",
+	},
+	{
+		"missing-for-variable",
+		"{% for in xs %}{% end %}",
+	},
+	{
+		"missing-for-iterable",
+		"{% for x in %}{% end %}",
+	},
+	{
+		"extra-for-else-tag",
+		"{% for x in xs %}{% else %}{% else %}{% end %}",
+	},
+	{
+		"missing-include-path",
+		"{% include %}",
+	},
+	{
+		"non-string-include-path",
+		"{% include name %}",
+	},
+	{
+		"extends-after-tag",
+		"{{ a }}{% extends \"base.vie\" %}",
+	},
+	{
+		"nested-extends",
+		"{% if a %}{% extends \"base.vie\" %}{% end %}",
+	},
+	{
+		"missing-block-name",
+		"{% block %}{% end %}",
+	},
+	{
+		"missing-block-end",
+		"{% block body %}",
+	},
+	{
+		"missing-raw-end",
+		"{% raw %}{{ x }}",
+	},
+	{
+		"missing-set-value",
+		"{% set x = %}",
+	},
+	{
+		"missing-set-name",
+		"{% set = 1 %}",
+	},
+	{
+		"nested-macro",
+		"{% if a %}{% macro m() %}{% end %}{% end %}",
+	},
+	{
+		"duplicate-macro",
+		"{% macro m() %}{% end %}{% macro m() %}{% end %}",
+	},
+	{
+		"duplicate-macro-parameter",
+		"{% macro m(a, a) %}{% end %}",
+	},
+	{
+		"missing-macro-parameters",
+		"{% macro m %}{% end %}",
+	},
+	{
+		"missing-import-path",
+		"{% import %}",
+	},
+	{
+		"duplicate-block",
+		"{% block body %}{% end %}{% block body %}{% end %}",
+	},
 }
 
 func TestSource(t *testing.T) {
@@ -77,6 +215,96 @@ func TestSource(t *testing.T) {
 	}
 }
 
+func TestErrorList(t *testing.T) {
+	t.Parallel()
+
+	source := "{% end %}\n{% if x %}{% else %}{% else %}{% end %}\n{{ \"\\q\" }}"
+	_, err := parse.Options{}.File("a.vie", []byte(source))
+	var errs parse.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an error list, got %v", err)
+	}
+	expected := []string{
+		"a.vie:1:1: unexpected {% end %}",
+		"a.vie:2:21: unexpected else",
+		"a.vie:3:5: unknown escape sequence \\q",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], e)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	t.Parallel()
+
+	source := "a\n{% if x %}{{ f(y) | @g }}{% end %}\n{{ [1, 2] }}"
+	template, err := parse.Source([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ifBlock := template.Blocks[1].(*ast.IfBlock)
+	display := ifBlock.Branches[0].Consequence[0].(*ast.DisplayBlock)
+	pipe := display.Value.(*ast.PipeExpr)
+	list := template.Blocks[3].(*ast.DisplayBlock).Value
+	tests := []struct {
+		name string
+		node ast.Node
+		text string
+	}{
+		{"text", template.Blocks[0], "a\n"},
+		{"if", ifBlock, "{% if x %}{{ f(y) | @g }}{% end %}"},
+		{"condition", ifBlock.Branches[0].Condition, "x"},
+		{"display", display, "{{ f(y) | @g }}"},
+		{"pipe", pipe, "f(y) | @g"},
+		{"call", pipe.Argument, "f(y)"},
+		{"function", &pipe.Function, "@g"},
+		{"list", list, "[1, 2]"},
+	}
+	for _, test := range tests {
+		start, end := test.node.Start(), test.node.End()
+		if text := source[start.Offset:end.Offset]; text != test.text {
+			t.Errorf("%s: expected span %q, got %q", test.name, test.text, text)
+		}
+	}
+
+	expected := ast.Location{Line: 2, Column: 3, Offset: 40}
+	if start := list.Start(); start != expected {
+		t.Errorf("expected list at %v, got %v", expected, start)
+	}
+}
+
+func TestParseDelimiters(t *testing.T) {
+	t.Parallel()
+
+	d, err := parse.ParseDelimiters("[[ ]] [% %] [# #]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := parse.Delimiters{
+		DisplayOpen:    "[[",
+		DisplayClose:   "]]",
+		StatementOpen:  "[%",
+		StatementClose: "%]",
+		CommentOpen:    "[#",
+		CommentClose:   "#]",
+	}
+	if d != expected {
+		t.Errorf("expected %v, got %v", expected, d)
+	}
+
+	for _, s := range []string{"", "[[ ]]", "[ ] [% %] [# #]"} {
+		if _, err := parse.ParseDelimiters(s); err == nil {
+			t.Errorf("%q: expected error, got no error", s)
+		}
+	}
+}
+
 // TestSourceFuzz checks that [parse.Source] never panics on incomplete or
 // slightly modified input. It concatenates all [errorTests] sources, then
 // tests truncating from the start, truncating from the end, and removing each
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/vietmpl/vie/analysis"
 	"github.com/vietmpl/vie/parse"
 	"github.com/vietmpl/vie/render"
+	"github.com/vietmpl/vie/template"
 	"github.com/vietmpl/vie/value"
 )
 
 func newCmdRender() *cobra.Command {
+	var options render.Options
+	var delimiters parse.Delimiters
+	var escape string
+
 	cmd := &cobra.Command{
 		Use:  "render PATH [VAR=VALUE...] [VAR...]",
 		Args: cobra.MinimumNArgs(1),
@@ -22,7 +31,11 @@ func newCmdRender() *cobra.Command {
 				return err
 			}
 
-			f, err := parse.Source(src)
+			parseOptions, err := fileParseOptions(path, delimiters)
+			if err != nil {
+				return err
+			}
+			f, err := parseOptions.File(path, src)
 			if err != nil {
 				return err
 			}
@@ -31,27 +44,190 @@ func newCmdRender() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			include := template.IncludeFrom(templateRoot(path), parseOptions)
+			if err := template.ResolveExtends(f, include); err != nil {
+				return err
+			}
+			analyzer := analysis.NewAnalyzer()
+			analyzer.Include = include
+			analyzer.Template(f, path)
+			types, _ := analyzer.Results()
+			if err := coerceData(types, data); err != nil {
+				return err
+			}
 
-			out, err := render.Template(f, data)
-			if err != nil {
+			options.Include = include
+			if escape == "" {
+				options.Escape = render.EscapeFor(strings.TrimSuffix(path, ".vie"))
+			} else if err := options.Escape.UnmarshalText([]byte(escape)); err != nil {
 				return err
 			}
+
+			out, err := options.Template(f, data)
+			if err != nil {
+				return render.WithPath(path, err)
+			}
 			_, err = os.Stdout.Write(out)
 			return err
 		},
 	}
+
+	addRenderFlags(cmd, &options)
+	addDelimitersFlag(cmd, &delimiters)
+	cmd.Flags().StringVar(&escape, "escape", "", "Escaping of displayed values: none, html, xml, json, yaml or shell (default chosen from the file extension)")
+
 	return cmd
 }
 
+func addRenderFlags(cmd *cobra.Command, options *render.Options) {
+	cmd.Flags().BoolVar(&options.TrimBlocks, "trim-blocks", false, "Remove the first newline after a statement or comment tag")
+	cmd.Flags().BoolVar(&options.LstripBlocks, "lstrip-blocks", false, "Remove spaces and tabs before a statement or comment tag at the start of a line")
+}
+
+func addDelimitersFlag(cmd *cobra.Command, delimiters *parse.Delimiters) {
+	cmd.Flags().TextVar(delimiters, "delimiters", parse.Delimiters{}, `Delimiters of display, statement and comment tags, such as "[[ ]] [% %] [# #]"`)
+}
+
+// fileParseOptions returns the options to parse the template file path. Tags
+// are delimited by delimiters, or if it is the zero value, by the delimiters
+// set in the config file next to the template.
+func fileParseOptions(path string, delimiters parse.Delimiters) (parse.Options, error) {
+	if delimiters == (parse.Delimiters{}) {
+		config, err := template.LoadConfig(filepath.Dir(path))
+		if err != nil {
+			return parse.Options{}, err
+		}
+		delimiters = config.Delimiters
+	}
+	return parse.Options{Delimiters: delimiters}, nil
+}
+
+// templateRoot returns the root of the template holding the file path: the
+// directory in .vie it is in, or the directory of path if it is not in a
+// template. Included templates are resolved relative to it, as in vie new.
+func templateRoot(path string) string {
+	dir := filepath.Dir(path)
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for root := dir; ; root = filepath.Join(root, "..") {
+		parent := filepath.Dir(abs)
+		if filepath.Base(parent) == ".vie" {
+			return root
+		}
+		if parent == abs {
+			return dir
+		}
+		abs = parent
+	}
+}
+
+// parseData converts command line arguments into template data. VAR=VALUE
+// sets a string, VAR[]=VALUE appends a string to a list, and a bare VAR sets
+// a bool to true. VAR may be a dotted path such as entity.name to set a field
+// of a map.
 func parseData(args []string) (map[string]value.Value, error) {
 	data := make(map[string]value.Value)
 	for _, a := range args {
-		if strings.Contains(a, "=") {
-			kv := strings.SplitN(a, "=", 2)
-			data[kv[0]] = value.String(kv[1])
+		name, val, hasValue := strings.Cut(a, "=")
+		path := strings.Split(name, ".")
+		fields, err := lookupMap(data, path[:len(path)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		key := path[len(path)-1]
+		if !hasValue {
+			fields[key] = value.Bool(true)
+		} else if key, ok := strings.CutSuffix(key, "[]"); ok {
+			list, _ := fields[key].(value.List)
+			fields[key] = append(list, value.String(val))
 		} else {
-			data[a] = value.Bool(true)
+			fields[key] = value.String(val)
 		}
 	}
 	return data, nil
 }
+
+// lookupMap returns the map at path in data, creating missing maps.
+func lookupMap(data map[string]value.Value, path []string) (value.Map, error) {
+	m := value.Map(data)
+	for _, key := range path {
+		switch v := m[key].(type) {
+		case nil:
+			next := value.Map{}
+			m[key] = next
+			m = next
+		case value.Map:
+			m = v
+		default:
+			return nil, fmt.Errorf("%s is already set to a %s", key, v.Type())
+		}
+	}
+	return m, nil
+}
+
+// coerceData converts string arguments to integers where the template uses
+// them as integers.
+func coerceData(types map[string]value.Type, data map[string]value.Value) error {
+	for name, typ := range types {
+		v, ok := data[name]
+		if !ok {
+			continue
+		}
+		coerced, err := coerceValue(typ, v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		data[name] = coerced
+	}
+	return nil
+}
+
+func coerceValue(typ value.Type, v value.Value) (value.Value, error) {
+	switch t := typ.(type) {
+	case value.ListType:
+		list, ok := v.(value.List)
+		if !ok || t.Elem == nil {
+			return v, nil
+		}
+		coerced := make(value.List, len(list))
+		for i, elem := range list {
+			c, err := coerceValue(t.Elem, elem)
+			if err != nil {
+				return nil, err
+			}
+			coerced[i] = c
+		}
+		return coerced, nil
+
+	case value.MapType:
+		m, ok := v.(value.Map)
+		if !ok || t.Fields == nil {
+			return v, nil
+		}
+		for name, fieldType := range *t.Fields {
+			field, ok := m[name]
+			if !ok {
+				continue
+			}
+			c, err := coerceValue(fieldType, field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			m[name] = c
+		}
+		return m, nil
+
+	default:
+		s, ok := v.(value.String)
+		if !ok || typ != value.TypeInt {
+			return v, nil
+		}
+		n, err := strconv.ParseInt(string(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected int, got %q", s)
+		}
+		return value.Int(n), nil
+	}
+}
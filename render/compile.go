@@ -0,0 +1,738 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/builtin"
+	"github.com/vietmpl/vie/value"
+)
+
+// Program is a template compiled to be rendered repeatedly. Rendering a
+// program gives the same result as rendering its template with
+// [Options.Template], without walking the syntax tree: the functions called
+// by the template are resolved and its constant expressions and text are
+// evaluated once, when compiling. A Program is safe for concurrent use.
+type Program struct {
+	render blockFunc
+	// size is the size of the last output, to allocate the next one at
+	// once.
+	size atomic.Int64
+}
+
+// Compile compiles a parsed Vie template.
+func Compile(template *ast.Template) (*Program, error) {
+	return Options{}.Compile(template)
+}
+
+// Compile compiles a parsed Vie template to be rendered with the options o.
+//
+// The templates included and imported by template are loaded with
+// [Options.Include] when compiling. Errors that rendering always reports,
+// such as an unresolved base template, are returned by Compile; the others,
+// such as a missing template included by a block that is not always
+// rendered, are reported when rendering.
+func (o Options) Compile(template *ast.Template) (*Program, error) {
+	render, err := o.compile(template, edge{start: true}, edge{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{render: render}, nil
+}
+
+// Render renders p using the provided data.
+func (p *Program) Render(data map[string]value.Value) ([]byte, error) {
+	s := state{data: data}
+	s.buffer.Grow(int(p.size.Load()))
+	if err := p.render(&s); err != nil {
+		return nil, err
+	}
+	p.size.Store(int64(s.buffer.Len()))
+	return s.buffer.Bytes(), nil
+}
+
+// state is the state of a program being rendered, as the fields of the
+// same name of [renderer].
+type state struct {
+	data   map[string]value.Value
+	scope  *scope
+	depth  int
+	buffer bytes.Buffer
+}
+
+func (s *state) lookup(name string) value.Value {
+	for sc := s.scope; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[name]; ok {
+			return v
+		}
+	}
+	return s.data[name]
+}
+
+type (
+	blockFunc func(s *state) error
+	exprFunc  func(s *state) (value.Value, error)
+)
+
+// compiler compiles the blocks of a template. The blocks of a template
+// render differently depending on the templates it is included by, so a
+// template is compiled by a compiler of its own for each include block.
+type compiler struct {
+	options   Options
+	includes  []string
+	overrides map[string]*ast.NamedBlock
+	macros    map[string]*ast.MacroBlock
+	// macroBodies maps the macros called by the template to their compiled
+	// bodies, which are shared by all calls.
+	macroBodies map[*ast.MacroBlock]*compiledMacro
+}
+
+// compile compiles t enclosed by the tags described by before and after,
+// for a template included by the templates includes, innermost last, and
+// with the macros of the including template available.
+func (o Options) compile(t *ast.Template, before, after edge, includes []string, macros map[string]*ast.MacroBlock) (blockFunc, error) {
+	r := renderer{options: o, macros: macros}
+	base, err := r.enterTemplate(t)
+	if err != nil {
+		return nil, err
+	}
+	c := compiler{
+		options:     o,
+		includes:    includes,
+		overrides:   r.overrides,
+		macros:      r.macros,
+		macroBodies: make(map[*ast.MacroBlock]*compiledMacro),
+	}
+	return c.blocks(base.Blocks, before, after).blockFunc(), nil
+}
+
+// step is a compiled block of a sequence of blocks. It writes text, unless
+// run is set.
+type step struct {
+	text string
+	run  blockFunc
+	// block is the block the errors of run are located at.
+	block ast.Block
+}
+
+// failure returns a step failing with err at block.
+func failure(block ast.Block, err error) step {
+	return step{block: block, run: func(*state) error { return err }}
+}
+
+// blockFunc returns the function running st.
+func (st step) blockFunc() blockFunc {
+	if st.run != nil {
+		return st.run
+	}
+	text := st.text
+	return func(s *state) error {
+		s.buffer.WriteString(text)
+		return nil
+	}
+}
+
+// blocks compiles a sequence of blocks that is enclosed by the tags
+// described by before and after, as [renderer.renderBlocks] renders them.
+// Consecutive text, including constant display blocks, is joined into a
+// single step.
+func (c *compiler) blocks(b []ast.Block, before, after edge) step {
+	var steps []step
+	for i, block := range b {
+		var st step
+		if text, ok := block.(*ast.TextBlock); ok {
+			prev, next := before, after
+			if i > 0 {
+				prev = closingEdge(b[i-1])
+			}
+			if i < len(b)-1 {
+				next = openingEdge(b[i+1])
+			}
+			st.text = c.options.trimText(text.Content, prev, next)
+		} else {
+			st = c.block(block)
+		}
+
+		if st.run == nil {
+			if st.text == "" {
+				continue
+			}
+			if last := len(steps) - 1; last >= 0 && steps[last].run == nil {
+				steps[last].text += st.text
+				continue
+			}
+		}
+		steps = append(steps, st)
+	}
+
+	hasSet := slices.ContainsFunc(b, isSet)
+	if !hasSet && len(steps) == 0 {
+		return step{}
+	}
+	if !hasSet && len(steps) == 1 && steps[0].run == nil {
+		return steps[0]
+	}
+	return step{run: func(s *state) error {
+		// Variables bound by set blocks are visible until the end of the
+		// sequence.
+		if hasSet {
+			setScope := &scope{
+				vars:   make(map[string]value.Value),
+				parent: s.scope,
+			}
+			s.scope = setScope
+			defer func() { s.scope = setScope.parent }()
+		}
+		for _, st := range steps {
+			if st.run == nil {
+				s.buffer.WriteString(st.text)
+				continue
+			}
+			if err := st.run(s); err != nil {
+				return positioned(st.block, err)
+			}
+		}
+		return nil
+	}}
+}
+
+func (c *compiler) block(b ast.Block) step {
+	switch block := b.(type) {
+	case *ast.TextBlock:
+		return step{text: block.Content}
+
+	case *ast.CommentBlock:
+		// Comments do not produce output.
+		return step{}
+
+	case *ast.RawBlock:
+		return step{text: block.Content}
+
+	case *ast.DisplayBlock:
+		x := c.expr(block.Value)
+		safe := isSafe(block.Value, c.macros)
+		if x.constant {
+			if x.err != nil {
+				return failure(block, x.err)
+			}
+			text, err := c.options.display(x.value, safe)
+			if err != nil {
+				return failure(block, err)
+			}
+			return step{text: text}
+		}
+		options := c.options
+		return step{block: block, run: func(s *state) error {
+			v, err := x.eval(s)
+			if err != nil {
+				return err
+			}
+			text, err := options.display(v, safe)
+			if err != nil {
+				return err
+			}
+			s.buffer.WriteString(text)
+			return nil
+		}}
+
+	case *ast.IfBlock:
+		return c.ifBlock(block)
+
+	case *ast.SwitchBlock:
+		return c.switchBlock(block)
+
+	case *ast.ForBlock:
+		return c.forBlock(block)
+
+	case *ast.IncludeBlock:
+		name := string(value.FromBasicLit(&block.Path).(value.String))
+		if c.options.Include == nil {
+			return failure(block, fmt.Errorf("cannot include %q: includes are not supported", name))
+		}
+		if slices.Contains(c.includes, name) {
+			return failure(block, fmt.Errorf("include cycle: %s -> %s", strings.Join(c.includes, " -> "), name))
+		}
+		template, err := c.options.Include(name)
+		if err != nil {
+			return failure(block, err)
+		}
+		run, err := c.options.compile(template, edge{}, edge{}, append(slices.Clip(c.includes), name), c.macros)
+		if err != nil {
+			return failure(block, WithPath(name, err))
+		}
+		return step{block: block, run: func(s *state) error {
+			return WithPath(name, run(s))
+		}}
+
+	case *ast.ExtendsBlock:
+		// Templates extending another one are compiled as their base.
+		return step{}
+
+	case *ast.NamedBlock:
+		if override, ok := c.overrides[block.Name.Value]; ok {
+			block = override
+		}
+		body := c.blocks(block.Body, statementEdge(block.Trim.Right), statementEdge(block.EndTrim.Left))
+		body.block = block
+		return body
+
+	case *ast.SetBlock:
+		x := c.expr(block.Value)
+		name := block.Name.Value
+		return step{block: block, run: func(s *state) error {
+			v, err := x.eval(s)
+			if err != nil {
+				return err
+			}
+			s.scope.vars[name] = v
+			return nil
+		}}
+
+	case *ast.MacroBlock, *ast.ImportBlock:
+		// Macros are compiled when called.
+		return step{}
+
+	default:
+		panic(fmt.Sprintf("unexpected ast.Block: %T", block))
+	}
+}
+
+// branch is a compiled branch of an if block.
+type branch struct {
+	condition expr
+	body      blockFunc
+}
+
+// switchCase is a compiled case of a switch block.
+type switchCase struct {
+	values []expr
+	body   blockFunc
+}
+
+func (c *compiler) ifBlock(block *ast.IfBlock) step {
+	var branches []branch
+	for i, b := range block.Branches {
+		after := statementEdge(block.EndTrim.Left)
+		if i < len(block.Branches)-1 {
+			after = statementEdge(block.Branches[i+1].Trim.Left)
+		} else if block.Alternative != nil {
+			after = statementEdge(block.ElseTrim.Left)
+		}
+		body := c.blocks(b.Consequence, statementEdge(b.Trim.Right), after)
+
+		// Branches with constant conditions are chosen or dropped when
+		// compiling, until a condition that is not constant.
+		condition := c.expr(b.Condition)
+		if len(branches) == 0 && condition.constant && condition.err == nil {
+			if chosen, ok := condition.value.(value.Bool); ok || condition.value == nil {
+				if chosen {
+					body.block = block
+					return body
+				}
+				continue
+			}
+		}
+		branches = append(branches, branch{condition: condition, body: body.blockFunc()})
+	}
+	alternative := step{}
+	if block.Alternative != nil {
+		alternative = c.blocks(*block.Alternative,
+			statementEdge(block.ElseTrim.Right), statementEdge(block.EndTrim.Left))
+	}
+	if len(branches) == 0 {
+		alternative.block = block
+		return alternative
+	}
+
+	otherwise := alternative.blockFunc()
+	return step{block: block, run: func(s *state) error {
+		for _, b := range branches {
+			conditionValue, err := b.condition.eval(s)
+			if err != nil {
+				return err
+			}
+			condition, err := expectValueType[value.Bool](conditionValue)
+			if err != nil {
+				return err
+			}
+			if condition {
+				return b.body(s)
+			}
+		}
+		return otherwise(s)
+	}}
+}
+
+func (c *compiler) switchBlock(block *ast.SwitchBlock) step {
+	switchValue := c.expr(block.Value)
+	cases := make([]switchCase, len(block.Cases))
+	for i, sc := range block.Cases {
+		after := statementEdge(block.EndTrim.Left)
+		if i < len(block.Cases)-1 {
+			after = statementEdge(block.Cases[i+1].Trim.Left)
+		} else if block.Default != nil {
+			after = statementEdge(block.DefaultTrim.Left)
+		}
+		cases[i] = switchCase{
+			values: c.exprs(sc.Values),
+			body:   c.blocks(sc.Body, statementEdge(sc.Trim.Right), after).blockFunc(),
+		}
+	}
+	otherwise := step{}.blockFunc()
+	if block.Default != nil {
+		otherwise = c.blocks(*block.Default,
+			statementEdge(block.DefaultTrim.Right), statementEdge(block.EndTrim.Left)).blockFunc()
+	}
+
+	return step{block: block, run: func(s *state) error {
+		v, err := switchValue.eval(s)
+		if err != nil {
+			return err
+		}
+		for _, sc := range cases {
+			for _, x := range sc.values {
+				caseValue, err := x.eval(s)
+				if err != nil {
+					return err
+				}
+				eq, err := evalEqual(v, caseValue)
+				if err != nil {
+					return err
+				}
+				if eq == value.Bool(true) {
+					return sc.body(s)
+				}
+			}
+		}
+		return otherwise(s)
+	}}
+}
+
+func (c *compiler) forBlock(block *ast.ForBlock) step {
+	iterable := c.expr(block.Iterable)
+	variable := block.Variable.Value
+	bodyEnd := statementEdge(block.EndTrim.Left)
+	alternative := step{}.blockFunc()
+	if block.Alternative != nil {
+		bodyEnd = statementEdge(block.ElseTrim.Left)
+		alternative = c.blocks(*block.Alternative,
+			statementEdge(block.ElseTrim.Right), statementEdge(block.EndTrim.Left)).blockFunc()
+	}
+	body := c.blocks(block.Body, statementEdge(block.Trim.Right), bodyEnd).blockFunc()
+	hasLoop := usesLoop(block.Body)
+
+	return step{block: block, run: func(s *state) error {
+		iterableValue, err := iterable.eval(s)
+		if err != nil {
+			return err
+		}
+		list, err := expectValueType[value.List](iterableValue)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return alternative(s)
+		}
+
+		loopScope := &scope{
+			vars:   make(map[string]value.Value, 2),
+			parent: s.scope,
+		}
+		s.scope = loopScope
+		defer func() { s.scope = loopScope.parent }()
+
+		for i, item := range list {
+			if hasLoop {
+				loopScope.vars[loopVariable] = value.Map{
+					"index": value.Int(i),
+					"first": value.Bool(i == 0),
+					"last":  value.Bool(i == len(list)-1),
+				}
+			}
+			loopScope.vars[variable] = item
+			if err := body(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// usesLoop reports whether blocks may use the metadata of the loop they are
+// the body of. Included templates and overriding named blocks are assumed to
+// use it.
+func usesLoop(blocks []ast.Block) bool {
+	uses := false
+	for _, b := range blocks {
+		ast.Inspect(b, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.IncludeBlock, *ast.NamedBlock:
+				uses = true
+			case *ast.Identifier:
+				uses = uses || n.Value == loopVariable
+			}
+			return !uses
+		})
+	}
+	return uses
+}
+
+// expr is a compiled expression. Its errors are located at the innermost
+// expression that failed, as with [renderer.evalExpr].
+type expr struct {
+	eval exprFunc
+	// constant is set if the expression evaluates to value, or fails with
+	// err, in every render.
+	constant bool
+	value    value.Value
+	err      error
+}
+
+// constant returns the expression evaluating to v and err.
+func constant(v value.Value, err error) expr {
+	return expr{
+		eval:     func(*state) (value.Value, error) { return v, err },
+		constant: true,
+		value:    v,
+		err:      err,
+	}
+}
+
+// fold returns the expression evaluated by eval, which depends on nothing
+// but its operands. It is evaluated when compiling if its operands are
+// constant.
+func fold(eval exprFunc, operands ...expr) expr {
+	for _, x := range operands {
+		if !x.constant {
+			return expr{eval: eval}
+		}
+	}
+	return constant(eval(nil))
+}
+
+func (c *compiler) expr(e ast.Expr) expr {
+	switch e := e.(type) {
+	case *ast.BasicLiteral:
+		return constant(value.FromBasicLit(e), nil)
+
+	case *ast.Identifier:
+		name := e.Value
+		return expr{eval: func(s *state) (value.Value, error) {
+			return s.lookup(name), nil
+		}}
+
+	case *ast.BinaryExpr:
+		x, y := c.expr(e.LOperand), c.expr(e.ROperand)
+		operation := binaryOperation(e.Operator)
+		return fold(func(s *state) (value.Value, error) {
+			xValue, err := x.eval(s)
+			if err != nil {
+				return nil, err
+			}
+			yValue, err := y.eval(s)
+			if err != nil {
+				return nil, err
+			}
+			v, err := operation(xValue, yValue)
+			if err != nil {
+				return nil, positioned(e, err)
+			}
+			return v, nil
+		}, x, y)
+
+	case *ast.UnaryExpr:
+		x := c.expr(e.Operand)
+		operation := unaryOperation(e.Operator)
+		return fold(func(s *state) (value.Value, error) {
+			xValue, err := x.eval(s)
+			if err != nil {
+				return nil, err
+			}
+			v, err := operation(xValue)
+			if err != nil {
+				return nil, positioned(e, err)
+			}
+			return v, nil
+		}, x)
+
+	case *ast.ParenExpr:
+		return c.expr(e.Value)
+
+	case *ast.MemberExpr:
+		object := c.expr(e.Object)
+		member := e.Member.Value
+		return fold(func(s *state) (value.Value, error) {
+			objectValue, err := object.eval(s)
+			if err != nil {
+				return nil, err
+			}
+			m, err := expectValueType[value.Map](objectValue)
+			if err != nil {
+				return nil, positioned(e, err)
+			}
+			return m[member], nil
+		}, object)
+
+	case *ast.ListLiteral:
+		elements := c.exprs(e.Elements)
+		return fold(func(s *state) (value.Value, error) {
+			values, err := evalAll(s, elements)
+			if err != nil {
+				return nil, err
+			}
+			return value.List(values), nil
+		}, elements...)
+
+	case *ast.CallExpr:
+		return c.call(e, e.Function, c.exprs(e.Arguments))
+
+	case *ast.PipeExpr:
+		return c.call(e, e.Function, append([]expr{c.expr(e.Argument)}, c.exprs(e.Arguments)...))
+
+	case *ast.ConditionalExpr:
+		condition := c.expr(e.Condition)
+		consequence, alternative := c.expr(e.Consequence), c.expr(e.Alternative)
+		if condition.constant {
+			if condition.err != nil {
+				return condition
+			}
+			chosen, err := expectValueType[value.Bool](condition.value)
+			if err != nil {
+				return constant(nil, positioned(e, err))
+			}
+			// Only the chosen operand is evaluated.
+			if chosen {
+				return consequence
+			}
+			return alternative
+		}
+		return expr{eval: func(s *state) (value.Value, error) {
+			conditionValue, err := condition.eval(s)
+			if err != nil {
+				return nil, err
+			}
+			chosen, err := expectValueType[value.Bool](conditionValue)
+			if err != nil {
+				return nil, positioned(e, err)
+			}
+			if chosen {
+				return consequence.eval(s)
+			}
+			return alternative.eval(s)
+		}}
+
+	default:
+		panic(fmt.Sprintf("unexpected ast.Expr: %T", e))
+	}
+}
+
+func (c *compiler) exprs(list []ast.Expr) []expr {
+	compiled := make([]expr, len(list))
+	for i, x := range list {
+		compiled[i] = c.expr(x)
+	}
+	return compiled
+}
+
+func evalAll(s *state, list []expr) ([]value.Value, error) {
+	values := make([]value.Value, len(list))
+	for i, x := range list {
+		v, err := x.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// call compiles the call e of function with the arguments args. Calls to
+// built-in functions are constant if their arguments are.
+func (c *compiler) call(e ast.Expr, function ast.Identifier, args []expr) expr {
+	if macro, ok := c.macros[function.Value]; ok {
+		m := c.macro(macro)
+		return expr{eval: func(s *state) (value.Value, error) {
+			values, err := evalAll(s, args)
+			if err != nil {
+				return nil, err
+			}
+			v, err := m.call(s, values)
+			if err != nil {
+				return nil, positioned(e, err)
+			}
+			return v, nil
+		}}
+	}
+
+	// Arguments are evaluated before reporting an unknown function.
+	f, lookupErr := builtin.LookupFunction(function)
+	if lookupErr == nil && len(f.ArgTypes) != len(args) {
+		lookupErr = fmt.Errorf("function %s expects %d arguments, got %d",
+			f.Name, len(f.ArgTypes), len(args))
+	}
+	return fold(func(s *state) (value.Value, error) {
+		values, err := evalAll(s, args)
+		if err != nil {
+			return nil, err
+		}
+		if lookupErr != nil {
+			return nil, positioned(e, lookupErr)
+		}
+		v, err := f.Call(values)
+		if err != nil {
+			return nil, positioned(e, err)
+		}
+		return v, nil
+	}, args...)
+}
+
+// compiledMacro is a macro compiled for the calls of a template.
+type compiledMacro struct {
+	macro *ast.MacroBlock
+	// body is set once the body is compiled, after the macro is made
+	// available to recursive calls in it.
+	body blockFunc
+}
+
+func (c *compiler) macro(macro *ast.MacroBlock) *compiledMacro {
+	if m, ok := c.macroBodies[macro]; ok {
+		return m
+	}
+	m := &compiledMacro{macro: macro}
+	c.macroBodies[macro] = m
+	m.body = c.blocks(macro.Body,
+		statementEdge(macro.Trim.Right), statementEdge(macro.EndTrim.Left)).blockFunc()
+	return m
+}
+
+// call renders the body of m with its parameters bound to args, as
+// [renderer.callMacro] does.
+func (m *compiledMacro) call(s *state, args []value.Value) (value.Value, error) {
+	if len(m.macro.Parameters) != len(args) {
+		return nil, fmt.Errorf("macro %s expects %d arguments, got %d",
+			m.macro.Name.Value, len(m.macro.Parameters), len(args))
+	}
+	if s.depth >= maxMacroDepth {
+		return nil, fmt.Errorf("macro %s: maximum call depth exceeded", m.macro.Name.Value)
+	}
+
+	vars := make(map[string]value.Value, len(args))
+	for i, parameter := range m.macro.Parameters {
+		vars[parameter.Value] = args[i]
+	}
+	// Macros see their parameters and the template data, but not the
+	// variables bound at the call site.
+	ms := state{
+		data:  s.data,
+		scope: &scope{vars: vars},
+		depth: s.depth + 1,
+	}
+	if err := m.body(&ms); err != nil {
+		return nil, err
+	}
+	return value.String(ms.buffer.String()), nil
+}
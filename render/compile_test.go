@@ -0,0 +1,271 @@
+package render_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/render"
+	"github.com/vietmpl/vie/template"
+	"github.com/vietmpl/vie/value"
+)
+
+// TestCompile checks that programs render the templates of the other tests
+// like the interpreter, with the same errors.
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	type compileTest struct {
+		source  string
+		data    map[string]value.Value
+		options render.Options
+	}
+	tests := make(map[string]compileTest)
+	for name, test := range noDataTests {
+		tests[name] = compileTest{source: test.source}
+	}
+	for name, test := range dataTests {
+		tests[name] = compileTest{source: test.source, data: test.data}
+	}
+	for name, test := range errorTests {
+		tests["error "+name] = compileTest{source: test.source, data: test.data}
+	}
+	for name, test := range optionsTests {
+		tests["options "+name] = compileTest{source: test.source, options: test.options}
+	}
+	for name, test := range includeTests {
+		tests["include "+name] = compileTest{source: test.source, options: includeOptions()}
+	}
+	for name, source := range includeErrorTests {
+		tests["include error "+name] = compileTest{source: source, options: includeOptions()}
+	}
+	tests["constants"] = compileTest{
+		source: `{{ "a" ~ "b" | @upper }}{% if 1 + 2 == 3 %}{{ [1, 2] | @len }}{% end %}` +
+			`{{ true ? "c" : x }}{{ x ? 1 / 0 : "d" }}`,
+		data: map[string]value.Value{"x": value.Bool(false)},
+	}
+	tests["constant error in branch"] = compileTest{
+		source: `{% if x %}{{ 1 / 0 }}{% end %}{% if false %}{{ true }}{% end %}`,
+	}
+	tests["recursive macro"] = compileTest{
+		source: `{% macro count(n) %}{{ n }}{% if n > 0 %}{{ count(n - 1) }}{% end %}{% end %}{{ count(3) }}`,
+	}
+	tests["set"] = compileTest{
+		source: `{% set a = "x" %}{% for i in [1, 2] %}{% set a = a ~ i %}{{ a }}{% end %}{{ a }}`,
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := parse.Source([]byte(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.options.Include != nil {
+				if err := template.ResolveExtends(f, test.options.Include); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, expectedErr := test.options.Template(f, test.data)
+			program, err := test.options.Compile(f)
+			var actual []byte
+			if err == nil {
+				actual, err = program.Render(test.data)
+			}
+			if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+				t.Fatalf("expected error %v, got %v", expectedErr, err)
+			}
+			if string(actual) != string(expected) {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompileErrorSpan(t *testing.T) {
+	t.Parallel()
+
+	template, err := parse.Source([]byte("{{ name }}\n{{ name | @upper(n - 1) }}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := render.Compile(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = program.Render(map[string]value.Value{
+		"name": value.String("vie"),
+		"n":    value.String("1"),
+	})
+	var renderErr *render.Error
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a render error, got %v", err)
+	}
+	start := ast.Location{Line: 1, Column: 17, Offset: 28}
+	end := ast.Location{Line: 1, Column: 22, Offset: 33}
+	if renderErr.Start != start || renderErr.End != end {
+		t.Errorf("expected error at %v-%v, got %v-%v", start, end, renderErr.Start, renderErr.End)
+	}
+}
+
+func TestCompileOverflow(t *testing.T) {
+	t.Parallel()
+
+	// The first expression is folded when compiling, the second is not.
+	for _, source := range []string{"{{ 9223372036854775807 + 1 }}", "{{ n + 1 }}"} {
+		template, err := parse.Source([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := render.Compile(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = program.Render(map[string]value.Value{"n": value.Int(math.MaxInt64)})
+		if expected := "1:4: integer overflow"; fmt.Sprint(err) != expected {
+			t.Errorf("%s: expected error %q, got %v", source, expected, err)
+		}
+	}
+}
+
+func TestCompileUnresolvedExtends(t *testing.T) {
+	t.Parallel()
+
+	template, err := parse.Source([]byte(`{% extends "base.vie" %}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := render.Compile(template); err == nil {
+		t.Errorf("expected error for an unresolved base template, got no error")
+	}
+}
+
+// includeOptions returns options including the partials of TestInclude.
+func includeOptions() render.Options {
+	var options render.Options
+	options.Include = func(name string) (*ast.Template, error) {
+		source, ok := includePartials[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		partial, err := parse.Source([]byte(source))
+		if err != nil {
+			return nil, err
+		}
+		return partial, template.ResolveExtends(partial, options.Include)
+	}
+	return options
+}
+
+// benchmarkSources are templates rendered with benchmarkData: code
+// generation, which mostly calls built-in functions, and logic, which mostly
+// evaluates operators.
+var benchmarkSources = map[string]string{
+	"generate": `// Code generated by vie. DO NOT EDIT.
+
+package {{ package | @snake }}
+
+{% macro field(name, type) %}	{{ name | @pascal }} {{ type }} ` + "`json:\"{{ name | @camel }}\"`" + `{% end %}
+// {{ entity | @pascal }} is a {{ entity | @lower }} stored in the {{ "database" | @upper }}.
+type {{ entity | @pascal }} struct {
+{% for f in fields %}{{ field(f.name, f.type) }}
+{% end %}}
+
+{% for f in fields %}
+// {{ f.name | @pascal }} returns the {{ f.name | @replace("_", " ") }} of the {{ entity | @lower }}.
+func (x *{{ entity | @pascal }}) {{ f.name | @pascal }}() {{ f.type }} {
+	{% if loop.first %}// {{ 60 * 60 }} seconds
+	{% end %}return x.{{ f.name | @pascal }}
+}
+{% end %}
+{% if fields | @len > 3 %}const manyFields = {{ fields | @len }}{% else %}const manyFields = {{ 2 + 1 > 3 ? "yes" : "no" }}{% end %}
+`,
+	"logic": `{% for f in fields %}{% for g in fields %}
+{%- if f.name != g.name and (f.type == g.type or f.name in ["id", "email"]) -%}
+{{ loop.index * 2 + 1 }}:{{ f.name ~ "-" ~ g.name }}{{ loop.last ? ";" : "," }}
+{%- elseif f.name < g.name %}<{% else %}>{% end %}
+{%- switch g.type %}{% case "int", "bool" %}n{% default %}{{ 10 - 2 * 3 }}{% end %}
+{%- end %}{% end %}`,
+}
+
+var benchmarkData = func() map[string]value.Value {
+	var fields value.List
+	for _, name := range []string{"id", "created_at", "user_name", "email", "password_hash", "role"} {
+		fields = append(fields, value.Map{
+			"name": value.String(name),
+			"type": value.String("string"),
+		})
+	}
+	return map[string]value.Value{
+		"package": value.String("UserModels"),
+		"entity":  value.String("user_account"),
+		"fields":  fields,
+	}
+}()
+
+func BenchmarkTemplate(b *testing.B) {
+	for name, source := range benchmarkSources {
+		b.Run(name, func(b *testing.B) {
+			template, err := parse.Source([]byte(source))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := render.Template(template, benchmarkData); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProgram(b *testing.B) {
+	for name, source := range benchmarkSources {
+		b.Run(name, func(b *testing.B) {
+			template, err := parse.Source([]byte(source))
+			if err != nil {
+				b.Fatal(err)
+			}
+			program, err := render.Compile(template)
+			if err != nil {
+				b.Fatal(err)
+			}
+			expected, err := render.Template(template, benchmarkData)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if actual, err := program.Render(benchmarkData); err != nil || string(actual) != string(expected) {
+				b.Fatalf("expected %q, got %q (%v)", expected, actual, err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := program.Render(benchmarkData); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCompile(b *testing.B) {
+	for name, source := range benchmarkSources {
+		b.Run(name, func(b *testing.B) {
+			template, err := parse.Source([]byte(source))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := render.Compile(template); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vietmpl/vie/ast"
+)
+
+// Error is an error that occurred while rendering the source range from
+// Start to End of the file Path, which is empty if unknown.
+type Error struct {
+	Path  string
+	Start ast.Location
+	End   ast.Location
+	Err   error
+}
+
+// Error returns the message prefixed by the path, if any, and the 1-based
+// line and column of the start of the range.
+func (e *Error) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s:%s: %s", e.Path, e.Start, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Start, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// positioned returns err located at the span of n, unless err is already
+// located at a node inside n.
+func positioned(n ast.Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	var located *Error
+	if errors.As(err, &located) {
+		return err
+	}
+	return &Error{Start: n.Start(), End: n.End(), Err: err}
+}
+
+// WithPath returns err attributed to the file path: an [Error] not
+// attributed to a file yet gets path as its Path, and other errors are
+// prefixed by path.
+func WithPath(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var located *Error
+	if !errors.As(err, &located) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if located.Path != "" {
+		return err
+	}
+	attributed := *located
+	attributed.Path = path
+	return &attributed
+}
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// Escape is a mode of escaping the values displayed by a template for the
+// format of its output. Values are escaped to be written inside a string of
+// the format, such as between the quotes of a JSON string or of a
+// single-quoted shell word.
+type Escape uint8
+
+const (
+	// EscapeNone displays values as they are.
+	EscapeNone Escape = iota
+	// EscapeHTML escapes values for HTML text and attribute values.
+	EscapeHTML
+	// EscapeXML escapes values for XML text and attribute values.
+	EscapeXML
+	// EscapeJSON escapes values for JSON strings.
+	EscapeJSON
+	// EscapeYAML escapes values for double-quoted YAML strings. The
+	// template must display the values between double quotes.
+	EscapeYAML
+	// EscapeShell escapes values for single-quoted shell strings. The
+	// template must display the values between single quotes.
+	EscapeShell
+)
+
+var escapeNames = [...]string{
+	EscapeNone:  "none",
+	EscapeHTML:  "html",
+	EscapeXML:   "xml",
+	EscapeJSON:  "json",
+	EscapeYAML:  "yaml",
+	EscapeShell: "shell",
+}
+
+// escapeExtensions maps file extensions to the escaping of their format.
+// YAML and shell values may be written with any quoting, or none, so
+// [EscapeYAML] and [EscapeShell] are only used when requested.
+var escapeExtensions = map[string]Escape{
+	".htm":  EscapeHTML,
+	".html": EscapeHTML,
+	".svg":  EscapeXML,
+	".xml":  EscapeXML,
+	".json": EscapeJSON,
+}
+
+// EscapeFor returns the escaping of the output file path, chosen from its
+// extension. It returns [EscapeNone] for unknown extensions.
+func EscapeFor(path string) Escape {
+	return escapeExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// String returns the name of the escaping mode.
+func (e Escape) String() string {
+	return escapeNames[e]
+}
+
+// MarshalText implements [encoding.TextMarshaler].
+func (e Escape) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (e *Escape) UnmarshalText(text []byte) error {
+	for mode, name := range escapeNames {
+		if string(text) == name {
+			*e = Escape(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown escaping %q", text)
+}
+
+var (
+	xmlReplacer   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "'", "&apos;")
+	shellReplacer = strings.NewReplacer("'", `'\''`)
+)
+
+func (e Escape) escape(s string) string {
+	switch e {
+	case EscapeNone:
+		return s
+	case EscapeHTML:
+		return html.EscapeString(s)
+	case EscapeXML:
+		return xmlReplacer.Replace(s)
+	case EscapeJSON, EscapeYAML:
+		// Escape sequences of JSON strings are valid in double-quoted YAML
+		// strings.
+		var b strings.Builder
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		// Encoding a string cannot fail.
+		_ = encoder.Encode(s)
+		quoted := strings.TrimSuffix(b.String(), "\n")
+		return quoted[1 : len(quoted)-1]
+	case EscapeShell:
+		return shellReplacer.Replace(s)
+	default:
+		panic(fmt.Sprintf("unexpected escaping: %d", e))
+	}
+}
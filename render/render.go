@@ -6,12 +6,36 @@ import (
 	"github.com/vietmpl/vie/value"
 )
 
+// Options configures how templates are rendered.
+type Options struct {
+	// TrimBlocks removes the first newline after a statement or comment
+	// tag.
+	TrimBlocks bool
+	// LstripBlocks removes spaces and tabs from the start of a line up to a
+	// statement or comment tag.
+	LstripBlocks bool
+	// Include returns the template named by an include block. Templates
+	// containing include blocks fail to render if it is nil.
+	Include func(name string) (*ast.Template, error)
+	// Escape escapes the values of display blocks for the format of the
+	// output. Values piped to @safe and the results of macros, whose
+	// values are already escaped, are displayed as they are.
+	Escape Escape
+}
+
 // Template renders a parsed Vie template using the provided data.
 func Template(template *ast.Template, data map[string]value.Value) ([]byte, error) {
+	return Options{}.Template(template, data)
+}
+
+// Template renders a parsed Vie template using the provided data and the
+// options o.
+func (o Options) Template(template *ast.Template, data map[string]value.Value) ([]byte, error) {
 	r := renderer{
-		data: data,
+		options: o,
+		data:    data,
 	}
-	if err := r.renderBlocks(template.Blocks); err != nil {
+	if err := r.renderTemplate(template, edge{start: true}, edge{}); err != nil {
 		return nil, err
 	}
 	return r.buffer.Bytes(), nil
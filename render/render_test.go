@@ -1,10 +1,15 @@
 package render_test
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"testing"
 
+	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/parse"
 	"github.com/vietmpl/vie/render"
+	"github.com/vietmpl/vie/template"
 	"github.com/vietmpl/vie/value"
 )
 
@@ -20,6 +25,10 @@ var noDataTests = map[string]struct {
 		"{# #}",
 		"",
 	},
+	"multiline comment": {
+		"a{#\n  notes\n\n  {{ x }}\n#}b",
+		"ab",
+	},
 	"display string literal": {
 		"{{ \"str\" }}",
 		"str",
@@ -28,6 +37,26 @@ var noDataTests = map[string]struct {
 		"{{ undefined }}",
 		"",
 	},
+	"display escape sequences": {
+		"{{ \"a\\tb\\n\\u00e9\\\\\" }}",
+		"a\tb\né\\",
+	},
+	"display single-quoted string": {
+		"{{ 'say \"hi\"' }}",
+		"say \"hi\"",
+	},
+	"display raw string": {
+		"{{ `a\\n\"b\"` }}",
+		"a\\n\"b\"",
+	},
+	"display pipe with arguments": {
+		"{{ \"a-b\" | @replace(\"-\", \"_\") | @upper }}",
+		"A_B",
+	},
+	"macro pipe with arguments": {
+		"{% macro wrap(s, l, r) %}{{ l }}{{ s }}{{ r }}{% end %}{{ \"x\" | wrap(\"<\", \">\") }}",
+		"<x>",
+	},
 	"display call": {
 		"{{ @upper(\"str\") }}",
 		"STR",
@@ -60,10 +89,106 @@ var noDataTests = map[string]struct {
 		"{% if false %}1{% else %}2{% end %}",
 		"2",
 	},
+	"if true else branch": {
+		"{% if true %}1{% else %}2{% end %}",
+		"1",
+	},
 	"if elseif branch": {
 		"{% if false %}1{% elseif true %}2{% end %}",
 		"2",
 	},
+	"for list literal": {
+		"{% for x in [\"a\", \"b\"] %}{{ x }}{% end %}",
+		"ab",
+	},
+	"for empty list literal": {
+		"{% for x in [] %}1{% else %}2{% end %}",
+		"2",
+	},
+	"join": {
+		"{{ @join([\"a\", \"b\"], \", \") }}",
+		"a, b",
+	},
+	"split": {
+		"{% for x in @split(\"a,b\", \",\") %}{{ x }};{% end %}",
+		"a;b;",
+	},
+	"contains": {
+		"{% if @contains([\"a\", \"b\"], \"b\") %}1{% end %}",
+		"1",
+	},
+	"member of undefined": {
+		"{{ undefined.name }}",
+		"",
+	},
+	"display int": {
+		"{{ 42 }}",
+		"42",
+	},
+	"arithmetic": {
+		"{{ 1 + 2 * 3 - 8 / 4 }}",
+		"5",
+	},
+	"remainder": {
+		"{{ 7 % 3 }}",
+		"1",
+	},
+	"negation": {
+		"{{ -(2 - 5) }}",
+		"3",
+	},
+	"int less": {
+		"{% if 1 < 2 %}1{% end %}",
+		"1",
+	},
+	"int greater equal": {
+		"{% if 2 >= 2 %}1{% end %}",
+		"1",
+	},
+	"string less": {
+		"{% if \"a\" < \"b\" %}1{% end %}",
+		"1",
+	},
+	"string greater": {
+		"{% if \"a\" > \"b\" %}1{% end %}",
+		"",
+	},
+	"int equal": {
+		"{% if 1 + 1 == 2 %}1{% end %}",
+		"1",
+	},
+	"len": {
+		"{{ @len([\"a\", \"b\"]) }}",
+		"2",
+	},
+	"loop index": {
+		"{% for x in [\"a\", \"b\"] %}{{ loop.index }}{{ x }}{% end %}",
+		"0a1b",
+	},
+	"trim display": {
+		"a \n {{- \"b\" -}} \n c",
+		"abc",
+	},
+	"trim comment": {
+		"a {#- comment -#} b",
+		"ab",
+	},
+	"trim if tags": {
+		"a\n{%- if true -%}\n  b\n{%- else -%}\n  c\n{%- end -%}\nd",
+		"abd",
+	},
+	"trim only one side": {
+		"a\n{%- if true %}\nb\n{% end -%}\nc",
+		"a\nb\nc",
+	},
+	"trim for tags": {
+		"{% for x in [\"a\", \"b\"] -%}\n  {{ x }}\n{%- end %}",
+		"ab",
+	},
+	"for undefined": {
+		"{% for x in undefined %}1{% else %}2{% end %}",
+		"2",
+	},
 	"if undefined": {
 		"{% if undefined %}1{% end %}",
 		"",
@@ -88,6 +213,70 @@ var noDataTests = map[string]struct {
 		"{% if \"a\" != \"b\" %}1{% end %}",
 		"1",
 	},
+	"raw": {
+		"{% raw %}{{ x }} {% if y %}{% end %}",
+		"{{ x }} {% if y %}",
+	},
+	"raw keeps whitespace": {
+		"a {%- raw -%} {{ x }} {%- end -%} b",
+		"a {{ x }} b",
+	},
+	"set": {
+		"{% set x = \"a\" | @upper %}{{ x }}{{ x }}",
+		"AA",
+	},
+	"set shadows variable": {
+		"{% set x = \"a\" %}{% if true %}{% set x = \"b\" %}{{ x }}{% end %}{{ x }}",
+		"ba",
+	},
+	"set in loop body": {
+		"{% for x in [\"a\", \"b\"] %}{% set y = x | @upper %}{{ y }}{% end %}{{ y }}",
+		"AB",
+	},
+	"macro call": {
+		"{% macro greet(name) %}hi {{ name }}{% end %}{{ greet(\"bob\") }}",
+		"hi bob",
+	},
+	"macro pipe": {
+		"{{ \"bob\" | greet }}{% macro greet(name) %}hi {{ name }}{% end %}",
+		"hi bob",
+	},
+	"macro calls macro": {
+		"{% macro a(x) %}[{{ b(x) }}]{% end %}{% macro b(x) %}{{ x | @upper }}{% end %}{{ a(\"x\") }}",
+		"[X]",
+	},
+	"in string": {
+		"{{ \"b\" in \"abc\" ? \"y\" : \"n\" }}{{ \"d\" in \"abc\" ? \"y\" : \"n\" }}",
+		"yn",
+	},
+	"in list": {
+		"{% if 2 in [1, 2] %}y{% end %}{% if \"c\" not in [\"a\", \"b\"] %}y{% end %}",
+		"yy",
+	},
+	"switch": {
+		"{% switch \"b\" %}{% case \"a\" %}A{% case \"b\", \"c\" %}B{% default %}D{% end %}",
+		"B",
+	},
+	"switch default": {
+		"{% switch 3 %} {% case 1, 2 %}A{% default %}D{% end %}",
+		"D",
+	},
+	"switch without match": {
+		"{% switch 3 %}{% case 1 %}A{% end %}",
+		"",
+	},
+	"conditional": {
+		"{{ true ? \"a\" : \"b\" }}{{ false ? \"a\" : \"b\" }}",
+		"ab",
+	},
+	"conditional evaluates chosen operand only": {
+		"{{ false ? 1 / 0 : 2 }}",
+		"2",
+	},
+	"macro does not see loop variables": {
+		"{% macro show() %}{{ x }}{% end %}{% for x in [\"a\"] %}{{ show() }}{% end %}",
+		"",
+	},
 }
 
 var dataTests = map[string]struct {
@@ -102,6 +291,73 @@ var dataTests = map[string]struct {
 			"a": value.String("foo"),
 		},
 	},
+	"for": {
+		"{% for x in xs %}{{ x }},{% end %}",
+		"a,b,",
+		map[string]value.Value{
+			"xs": value.List{value.String("a"), value.String("b")},
+		},
+	},
+	"for else": {
+		"{% for x in xs %}{{ x }}{% else %}empty{% end %}",
+		"empty",
+		map[string]value.Value{
+			"xs": value.List{},
+		},
+	},
+	"for shadows variable": {
+		"{% for x in xs %}{{ x }}{% end %}{{ x }}",
+		"ab",
+		map[string]value.Value{
+			"x":  value.String("b"),
+			"xs": value.List{value.String("a")},
+		},
+	},
+	"member": {
+		"{{ entity.name }}",
+		"User",
+		map[string]value.Value{
+			"entity": value.Map{"name": value.String("User")},
+		},
+	},
+	"nested member": {
+		"{{ a.b.c }}",
+		"c",
+		map[string]value.Value{
+			"a": value.Map{"b": value.Map{"c": value.String("c")}},
+		},
+	},
+	"missing member": {
+		"{{ entity.name }}",
+		"",
+		map[string]value.Value{
+			"entity": value.Map{},
+		},
+	},
+	"loop metadata": {
+		"{% for x in xs %}{% if loop.first %}[{% end %}{{ x }}{% if loop.last %}]{% else %},{% end %}{% end %}",
+		"[a,b]",
+		map[string]value.Value{
+			"xs": value.List{value.String("a"), value.String("b")},
+		},
+	},
+	"pluralization": {
+		"{{ count }} file{% if count > 1 %}s{% end %}",
+		"3 files",
+		map[string]value.Value{
+			"count": value.Int(3),
+		},
+	},
+	"nested for": {
+		"{% for row in rows %}{% for x in row %}{{ x }}{% end %};{% end %}",
+		"ab;c;",
+		map[string]value.Value{
+			"rows": value.List{
+				value.List{value.String("a"), value.String("b")},
+				value.List{value.String("c")},
+			},
+		},
+	},
 }
 
 var errorTests = map[string]struct {
@@ -112,6 +368,22 @@ var errorTests = map[string]struct {
 		"{{ true }}",
 		nil,
 	},
+	"in int": {
+		"{{ 1 in 2 }}",
+		nil,
+	},
+	"in list of lists": {
+		"{{ [1] in [[1]] }}",
+		nil,
+	},
+	"switch case type mismatch": {
+		"{% switch 1 %}{% case \"a\" %}{% end %}",
+		nil,
+	},
+	"conditional not bool": {
+		"{{ \"a\" ? \"b\" : \"c\" }}",
+		nil,
+	},
 	"display not bool": {
 		"{{ !true }}",
 		nil,
@@ -164,6 +436,90 @@ var errorTests = map[string]struct {
 		"{% if \"\" == false %}{% end %}",
 		nil,
 	},
+	"join list of bools": {
+		"{{ @join([true], \"\") }}",
+		nil,
+	},
+	"compare lists": {
+		"{% if [] == [] %}{% end %}",
+		nil,
+	},
+	"member of string": {
+		"{{ \"str\".name }}",
+		nil,
+	},
+	"division by zero": {
+		"{{ 1 / 0 }}",
+		nil,
+	},
+	"remainder by zero": {
+		"{{ 1 % 0 }}",
+		nil,
+	},
+	"add overflow": {
+		"{{ 9223372036854775807 + 1 }}",
+		nil,
+	},
+	"subtract overflow": {
+		"{{ -9223372036854775807 - 2 }}",
+		nil,
+	},
+	"join mixed list": {
+		`{{ ["a", 1] | @join(",") }}`,
+		nil,
+	},
+	"multiply overflow": {
+		"{{ n * 2 }}",
+		map[string]value.Value{"n": value.Int(math.MaxInt64)},
+	},
+	"negate overflow": {
+		"{{ -n }}",
+		map[string]value.Value{"n": value.Int(math.MinInt64)},
+	},
+	"divide overflow": {
+		"{{ n / -1 }}",
+		map[string]value.Value{"n": value.Int(math.MinInt64)},
+	},
+	"add strings": {
+		"{{ \"a\" + \"b\" }}",
+		nil,
+	},
+	"compare int and string": {
+		"{% if 1 < \"a\" %}{% end %}",
+		nil,
+	},
+	"order bools": {
+		"{% if false < true %}{% end %}",
+		nil,
+	},
+	"negate string": {
+		"{{ -\"a\" }}",
+		nil,
+	},
+	"for over string": {
+		"{% for x in \"abc\" %}{% end %}",
+		nil,
+	},
+	"include without loader": {
+		"{% include \"a.vie\" %}",
+		nil,
+	},
+	"macro argument count": {
+		"{% macro greet(name) %}{% end %}{{ greet() }}",
+		nil,
+	},
+	"undefined macro": {
+		"{{ greet(\"bob\") }}",
+		nil,
+	},
+	"macro recursion": {
+		"{% macro recurse() %}{{ recurse() }}{% end %}{{ recurse() }}",
+		nil,
+	},
+	"unresolved extends": {
+		"{% extends \"a.vie\" %}",
+		nil,
+	},
 }
 
 func TestTemplate(t *testing.T) {
@@ -199,6 +555,260 @@ func TestTemplate(t *testing.T) {
 	}
 }
 
+func TestErrorSpan(t *testing.T) {
+	t.Parallel()
+
+	template, err := parse.Source([]byte("{{ name }}\n{{ name | @upper(n - 1) }}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = render.Template(template, map[string]value.Value{
+		"name": value.String("vie"),
+		"n":    value.String("1"),
+	})
+	var renderErr *render.Error
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a render error, got %v", err)
+	}
+	// The error is reported at the innermost failing expression, n - 1.
+	start := ast.Location{Line: 1, Column: 17, Offset: 28}
+	end := ast.Location{Line: 1, Column: 22, Offset: 33}
+	if renderErr.Start != start || renderErr.End != end {
+		t.Errorf("expected error at %v-%v, got %v-%v", start, end, renderErr.Start, renderErr.End)
+	}
+}
+
+var optionsTests = map[string]struct {
+	source         string
+	expectedSource string
+	options        render.Options
+}{
+	"trim blocks": {
+		"{% if true %}\na\n{% end %}\nb",
+		"a\nb",
+		render.Options{TrimBlocks: true},
+	},
+	"trim blocks keeps display newline": {
+		"{{ \"a\" }}\nb",
+		"a\nb",
+		render.Options{TrimBlocks: true},
+	},
+	"trim blocks in switch": {
+		"{% switch 1 %}\n{% case 1 %}\na\n{% default %}\nb\n{% end %}\n",
+		"a\n",
+		render.Options{TrimBlocks: true},
+	},
+	"lstrip blocks": {
+		"  {% if true %}\n  a\n  {% end %}\n",
+		"\n  a\n\n",
+		render.Options{LstripBlocks: true},
+	},
+	"lstrip blocks only at line start": {
+		"a  {% if true %}b{% end %}",
+		"a  b",
+		render.Options{LstripBlocks: true},
+	},
+	"trim and lstrip blocks": {
+		"a\n  {% if true %}\n  b\n  {% end %}\nc",
+		"a\n  b\nc",
+		render.Options{TrimBlocks: true, LstripBlocks: true},
+	},
+	"escape html": {
+		"<p title=\"{{ \"<a & 'b'>\" }}\">{{ 1 }}</p>",
+		"<p title=\"&lt;a &amp; &#39;b&#39;&gt;\">1</p>",
+		render.Options{Escape: render.EscapeHTML},
+	},
+	"escape xml": {
+		"<a>{{ \"'<&>'\" }}</a>",
+		"<a>&apos;&lt;&amp;&gt;&apos;</a>",
+		render.Options{Escape: render.EscapeXML},
+	},
+	"escape json": {
+		"{\"a\": \"{{ \"say \\\"<hi>\\\"\\n\" }}\"}",
+		"{\"a\": \"say \\\"<hi>\\\"\\n\"}",
+		render.Options{Escape: render.EscapeJSON},
+	},
+	"escape shell": {
+		"echo '{{ \"it's\" }}'",
+		"echo 'it'\\''s'",
+		render.Options{Escape: render.EscapeShell},
+	},
+	"safe": {
+		"{{ \"<b>\" | @safe }}{{ @safe(\"<i>\") }}",
+		"<b><i>",
+		render.Options{Escape: render.EscapeHTML},
+	},
+	"macro result is escaped once": {
+		"{% macro m(x) %}<b>{{ x }}</b>{% end %}{{ m(\"&\") }}",
+		"<b>&amp;</b>",
+		render.Options{Escape: render.EscapeHTML},
+	},
+}
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range optionsTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			template, err := parse.Source([]byte(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := test.options.Template(template, nil)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if test.expectedSource != string(actual) {
+				t.Errorf("expected %q, got %q", test.expectedSource, actual)
+			}
+		})
+	}
+}
+
+var includeTests = map[string]struct {
+	source         string
+	expectedSource string
+}{
+	"include": {
+		"a{% include \"b.vie\" %}c",
+		"abc",
+	},
+	"include nested": {
+		"{% include \"nested.vie\" %}",
+		"[b]",
+	},
+	"include sees variables": {
+		"{% for x in [\"a\", \"b\"] %}{% include \"x.vie\" %}{% end %}",
+		"ab",
+	},
+	"include trim": {
+		"a\n{%- include \"b.vie\" -%}\nc",
+		"abc",
+	},
+	"extends": {
+		"{% extends \"base.vie\" %}ignored{% block b %}X{% end %}",
+		"<A>X",
+	},
+	"extends without overrides": {
+		"{% extends \"base.vie\" %}",
+		"<A>B",
+	},
+	"extends nested block": {
+		"{% extends \"nested-base.vie\" %}{% block inner %}X{% end %}",
+		"[(X)]",
+	},
+	"extends multiple levels": {
+		"{% extends \"child.vie\" %}{% block a %}Y{% end %}",
+		"<Y>X",
+	},
+	"import": {
+		"{% import \"macros.vie\" %}{{ greet(\"bob\") }}",
+		"hi bob",
+	},
+	"import prefers own macros": {
+		"{% import \"macros.vie\" %}{% macro greet(name) %}hello {{ name }}{% end %}{{ greet(\"bob\") }}",
+		"hello bob",
+	},
+	"include extending template": {
+		"{% include \"child.vie\" %}",
+		"<A>X",
+	},
+}
+
+var includeErrorTests = map[string]string{
+	"include not found": "{% include \"missing.vie\" %}",
+	"include cycle":     "{% include \"cycle.vie\" %}",
+	"import not found":  "{% import \"missing.vie\" %}",
+}
+
+// includePartials are the templates included by the include tests.
+var includePartials = map[string]string{
+	"b.vie":      "b",
+	"nested.vie": "[{% include \"b.vie\" %}]",
+	"x.vie":      "{{ x }}",
+	"cycle.vie":  "{% include \"cycle.vie\" %}",
+	"base.vie":   "<{% block a %}A{% end %}>{% block b %}B{% end %}",
+	"child.vie":  "{% extends \"base.vie\" %}{% block b %}X{% end %}",
+	"macros.vie": "{% macro greet(name) %}hi {{ name }}{% end %}",
+
+	"nested-base.vie": "[{% block outer %}({% block inner %}{% end %}){% end %}]",
+}
+
+func TestInclude(t *testing.T) {
+	t.Parallel()
+
+	var options render.Options
+	options = render.Options{
+		Include: func(name string) (*ast.Template, error) {
+			source, ok := includePartials[name]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", name)
+			}
+			partial, err := parse.Source([]byte(source))
+			if err != nil {
+				return nil, err
+			}
+			return partial, template.ResolveExtends(partial, options.Include)
+		},
+	}
+
+	for name, test := range includeTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := parse.Source([]byte(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := template.ResolveExtends(f, options.Include); err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := options.Template(f, nil)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if test.expectedSource != string(actual) {
+				t.Errorf("expected %q, got %q", test.expectedSource, actual)
+			}
+		})
+	}
+
+	for name, source := range includeErrorTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			template, err := parse.Source([]byte(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := options.Template(template, nil); err == nil {
+				t.Errorf("succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestIncludeErrorPath(t *testing.T) {
+	t.Parallel()
+
+	options := includeOptions()
+	template, err := parse.Source([]byte("a\n{% include \"cycle.vie\" %}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = options.Template(template, nil)
+	if expected := "cycle.vie:1:1: include cycle: cycle.vie -> cycle.vie"; fmt.Sprint(err) != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
 func expectRender(
 	t *testing.T,
 	source string,
@@ -3,6 +3,10 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/builtin"
@@ -11,19 +15,297 @@ import (
 )
 
 type renderer struct {
-	data   map[string]value.Value
+	options Options
+	data    map[string]value.Value
+	scope   *scope
+	// includes holds the names of the templates being included, innermost
+	// last, to detect include cycles.
+	includes []string
+	// overrides maps the names of the named blocks overridden by templates
+	// extending the one being rendered to the overriding blocks.
+	overrides map[string]*ast.NamedBlock
+	// macros maps the names of the macros available to the template being
+	// rendered to their definitions.
+	macros map[string]*ast.MacroBlock
+	// depth is the number of macro calls being rendered.
+	depth  int
 	buffer bytes.Buffer
 }
 
-func (r *renderer) renderBlocks(b []ast.Block) error {
-	for _, block := range b {
-		if err := r.renderBlock(block); err != nil {
+// maxMacroDepth limits the nesting of macro calls to stop runaway
+// recursion.
+const maxMacroDepth = 100
+
+// loopVariable is the name of the map holding metadata about the current
+// iteration of a for loop.
+const loopVariable = "loop"
+
+// scope holds variables bound by blocks such as for loops. Lookups fall back
+// to the parent scope and finally to the template data.
+type scope struct {
+	vars   map[string]value.Value
+	parent *scope
+}
+
+func (r *renderer) lookup(name string) value.Value {
+	for s := r.scope; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return r.data[name]
+}
+
+// edge describes the tag on one side of a sequence of blocks.
+type edge struct {
+	// trim is set if the tag has a whitespace control marker on the side
+	// facing the blocks.
+	trim bool
+	// statement is set for statement and comment tags, which are subject to
+	// [Options.TrimBlocks] and [Options.LstripBlocks].
+	statement bool
+	// start is set if there is no tag because the blocks start the template.
+	start bool
+}
+
+// renderTemplate renders t enclosed by the tags described by before and
+// after. A template extending another one renders as its base template, with
+// its named blocks overriding those of the base.
+func (r *renderer) renderTemplate(t *ast.Template, before, after edge) error {
+	overrides, macros := r.overrides, r.macros
+	defer func() { r.overrides, r.macros = overrides, macros }()
+
+	base, err := r.enterTemplate(t)
+	if err != nil {
+		return err
+	}
+	return r.renderBlocks(base.Blocks, before, after)
+}
+
+// enterTemplate sets the overrides and macros of r for rendering t, and
+// returns the template whose blocks render t: t itself, or the base
+// template at the end of the chain of templates it extends.
+func (r *renderer) enterTemplate(t *ast.Template) (*ast.Template, error) {
+	r.overrides = nil
+
+	// chain holds t followed by its bases, most derived first.
+	chain := []*ast.Template{t}
+	for extends := t.Extends(); extends != nil; extends = t.Extends() {
+		name := string(value.FromBasicLit(&extends.Path).(value.String))
+		if extends.Base == nil {
+			return nil, positioned(extends, fmt.Errorf("cannot extend %q: base template is not resolved", name))
+		}
+		if slices.Contains(chain, extends.Base) {
+			return nil, positioned(extends, fmt.Errorf("extends cycle at %q", name))
+		}
+		chain = append(chain, extends.Base)
+
+		if r.overrides == nil {
+			r.overrides = make(map[string]*ast.NamedBlock)
+		}
+		// Blocks of the most derived template take precedence.
+		for name, block := range ast.NamedBlocks(t.Blocks) {
+			if _, ok := r.overrides[name]; !ok {
+				r.overrides[name] = block
+			}
+		}
+		t = extends.Base
+	}
+
+	if err := r.defineMacros(chain); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// defineMacros makes the macros defined or imported by templates available
+// in addition to those of the enclosing template. Earlier templates take
+// precedence.
+func (r *renderer) defineMacros(templates []*ast.Template) error {
+	macros := make(map[string]*ast.MacroBlock)
+	for _, t := range templates {
+		if err := r.collectMacros(t, macros, nil); err != nil {
+			return err
+		}
+	}
+	for name, macro := range r.macros {
+		if _, ok := macros[name]; !ok {
+			macros[name] = macro
+		}
+	}
+	r.macros = macros
+	return nil
+}
+
+// collectMacros adds the macros defined or imported by t to macros, keeping
+// the existing ones. imports holds the names of the templates being
+// imported, innermost last.
+func (r *renderer) collectMacros(t *ast.Template, macros map[string]*ast.MacroBlock, imports []string) error {
+	var importBlocks []*ast.ImportBlock
+	ast.Inspect(t, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Template:
+			return true
+		case *ast.MacroBlock:
+			if _, ok := macros[n.Name.Value]; !ok {
+				macros[n.Name.Value] = n
+			}
+		case *ast.ImportBlock:
+			importBlocks = append(importBlocks, n)
+		}
+		// Macros and imports are at the top level of templates.
+		return false
+	})
+	for _, block := range importBlocks {
+		name := string(value.FromBasicLit(&block.Path).(value.String))
+		if r.options.Include == nil {
+			return positioned(block, fmt.Errorf("cannot import %q: imports are not supported", name))
+		}
+		if slices.Contains(imports, name) {
+			return positioned(block, fmt.Errorf("import cycle: %s -> %s", strings.Join(imports, " -> "), name))
+		}
+		imported, err := r.options.Include(name)
+		if err != nil {
+			return positioned(block, err)
+		}
+		if err := r.collectMacros(imported, macros, append(slices.Clip(imports), name)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// renderBlocks renders a sequence of blocks that is enclosed by the tags
+// described by before and after.
+func (r *renderer) renderBlocks(b []ast.Block, before, after edge) error {
+	// Variables bound by set blocks are visible until the end of the
+	// sequence.
+	if slices.ContainsFunc(b, isSet) {
+		setScope := &scope{
+			vars:   make(map[string]value.Value),
+			parent: r.scope,
+		}
+		r.scope = setScope
+		defer func() { r.scope = setScope.parent }()
+	}
+	for i, block := range b {
+		if text, ok := block.(*ast.TextBlock); ok {
+			prev, next := before, after
+			if i > 0 {
+				prev = closingEdge(b[i-1])
+			}
+			if i < len(b)-1 {
+				next = openingEdge(b[i+1])
+			}
+			r.renderText(text.Content, prev, next)
+			continue
+		}
+		if err := r.renderBlock(block); err != nil {
+			return positioned(block, err)
+		}
+	}
+	return nil
+}
+
+func isSet(b ast.Block) bool {
+	_, ok := b.(*ast.SetBlock)
+	return ok
+}
+
+// renderText writes text content, removing whitespace as requested by the
+// surrounding tags and the rendering options.
+func (r *renderer) renderText(content string, before, after edge) {
+	r.buffer.WriteString(r.options.trimText(content, before, after))
+}
+
+// trimText returns text content without the whitespace removed by the
+// surrounding tags and the options o.
+func (o Options) trimText(content string, before, after edge) string {
+	if after.trim {
+		content = strings.TrimRightFunc(content, unicode.IsSpace)
+	} else if o.LstripBlocks && after.statement {
+		i := strings.LastIndexByte(content, '\n')
+		if (i >= 0 || before.start) && strings.Trim(content[i+1:], " \t") == "" {
+			content = content[:i+1]
+		}
+	}
+
+	if before.trim {
+		content = strings.TrimLeftFunc(content, unicode.IsSpace)
+	} else if o.TrimBlocks && before.statement {
+		content = strings.TrimPrefix(content, "\n")
+	}
+	return content
+}
+
+// openingEdge describes the first tag of block.
+func openingEdge(block ast.Block) edge {
+	switch b := block.(type) {
+	case *ast.CommentBlock:
+		return edge{trim: b.Trim.Left, statement: true}
+	case *ast.RawBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.DisplayBlock:
+		return edge{trim: b.Trim.Left}
+	case *ast.IfBlock:
+		return statementEdge(b.Branches[0].Trim.Left)
+	case *ast.SwitchBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.ForBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.IncludeBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.ExtendsBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.NamedBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.MacroBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.SetBlock:
+		return statementEdge(b.Trim.Left)
+	case *ast.ImportBlock:
+		return statementEdge(b.Trim.Left)
+	default:
+		return edge{}
+	}
+}
+
+// closingEdge describes the last tag of block.
+func closingEdge(block ast.Block) edge {
+	switch b := block.(type) {
+	case *ast.CommentBlock:
+		return edge{trim: b.Trim.Right, statement: true}
+	case *ast.RawBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.DisplayBlock:
+		return edge{trim: b.Trim.Right}
+	case *ast.IfBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.SwitchBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.ForBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.IncludeBlock:
+		return statementEdge(b.Trim.Right)
+	case *ast.ExtendsBlock:
+		return statementEdge(b.Trim.Right)
+	case *ast.NamedBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.MacroBlock:
+		return statementEdge(b.EndTrim.Right)
+	case *ast.SetBlock:
+		return statementEdge(b.Trim.Right)
+	case *ast.ImportBlock:
+		return statementEdge(b.Trim.Right)
+	default:
+		return edge{}
+	}
+}
+
+func statementEdge(trim bool) edge {
+	return edge{trim: trim, statement: true}
+}
+
 func (r *renderer) renderBlock(b ast.Block) error {
 	switch block := b.(type) {
 	case *ast.TextBlock:
@@ -34,20 +316,24 @@ func (r *renderer) renderBlock(b ast.Block) error {
 		// Comments do not produce output.
 		return nil
 
+	case *ast.RawBlock:
+		r.buffer.WriteString(block.Content)
+		return nil
+
 	case *ast.DisplayBlock:
 		displayValue, err := r.evalExpr(block.Value)
 		if err != nil {
 			return err
 		}
-		stringValue, err := expectValueType[value.String](displayValue)
+		s, err := r.options.display(displayValue, isSafe(block.Value, r.macros))
 		if err != nil {
 			return err
 		}
-		r.buffer.WriteString(string(stringValue))
+		r.buffer.WriteString(s)
 		return nil
 
 	case *ast.IfBlock:
-		for _, branch := range block.Branches {
+		for i, branch := range block.Branches {
 			conditionValue, err := r.evalExpr(branch.Condition)
 			if err != nil {
 				return err
@@ -57,17 +343,125 @@ func (r *renderer) renderBlock(b ast.Block) error {
 				return err
 			}
 			if condition {
-				if err := r.renderBlocks(branch.Consequence); err != nil {
-					return err
+				after := statementEdge(block.EndTrim.Left)
+				if i < len(block.Branches)-1 {
+					after = statementEdge(block.Branches[i+1].Trim.Left)
+				} else if block.Alternative != nil {
+					after = statementEdge(block.ElseTrim.Left)
 				}
-				break
+				return r.renderBlocks(branch.Consequence, statementEdge(branch.Trim.Right), after)
 			}
 		}
 		if block.Alternative != nil {
-			if err := r.renderBlocks(*block.Alternative); err != nil {
+			return r.renderBlocks(*block.Alternative,
+				statementEdge(block.ElseTrim.Right), statementEdge(block.EndTrim.Left))
+		}
+		return nil
+
+	case *ast.SwitchBlock:
+		switchValue, err := r.evalExpr(block.Value)
+		if err != nil {
+			return err
+		}
+		for i, c := range block.Cases {
+			matched, err := r.matchCase(switchValue, c.Values)
+			if err != nil {
 				return err
 			}
+			if matched {
+				after := statementEdge(block.EndTrim.Left)
+				if i < len(block.Cases)-1 {
+					after = statementEdge(block.Cases[i+1].Trim.Left)
+				} else if block.Default != nil {
+					after = statementEdge(block.DefaultTrim.Left)
+				}
+				return r.renderBlocks(c.Body, statementEdge(c.Trim.Right), after)
+			}
+		}
+		if block.Default != nil {
+			return r.renderBlocks(*block.Default,
+				statementEdge(block.DefaultTrim.Right), statementEdge(block.EndTrim.Left))
+		}
+		return nil
+
+	case *ast.ForBlock:
+		iterableValue, err := r.evalExpr(block.Iterable)
+		if err != nil {
+			return err
+		}
+		list, err := expectValueType[value.List](iterableValue)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			if block.Alternative != nil {
+				return r.renderBlocks(*block.Alternative,
+					statementEdge(block.ElseTrim.Right), statementEdge(block.EndTrim.Left))
+			}
+			return nil
+		}
+
+		bodyEnd := statementEdge(block.EndTrim.Left)
+		if block.Alternative != nil {
+			bodyEnd = statementEdge(block.ElseTrim.Left)
+		}
+
+		loopScope := &scope{
+			vars:   make(map[string]value.Value, 2),
+			parent: r.scope,
+		}
+		r.scope = loopScope
+		defer func() { r.scope = loopScope.parent }()
+
+		for i, item := range list {
+			loopScope.vars[loopVariable] = value.Map{
+				"index": value.Int(i),
+				"first": value.Bool(i == 0),
+				"last":  value.Bool(i == len(list)-1),
+			}
+			loopScope.vars[block.Variable.Value] = item
+			if err := r.renderBlocks(block.Body, statementEdge(block.Trim.Right), bodyEnd); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.IncludeBlock:
+		name := string(value.FromBasicLit(&block.Path).(value.String))
+		if r.options.Include == nil {
+			return fmt.Errorf("cannot include %q: includes are not supported", name)
+		}
+		if slices.Contains(r.includes, name) {
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(r.includes, " -> "), name)
+		}
+		template, err := r.options.Include(name)
+		if err != nil {
+			return err
+		}
+		r.includes = append(r.includes, name)
+		defer func() { r.includes = r.includes[:len(r.includes)-1] }()
+		return WithPath(name, r.renderTemplate(template, edge{}, edge{}))
+
+	case *ast.ExtendsBlock:
+		// Templates extending another one are rendered by renderTemplate.
+		return nil
+
+	case *ast.NamedBlock:
+		if override, ok := r.overrides[block.Name.Value]; ok {
+			block = override
+		}
+		return r.renderBlocks(block.Body, statementEdge(block.Trim.Right), statementEdge(block.EndTrim.Left))
+
+	case *ast.SetBlock:
+		v, err := r.evalExpr(block.Value)
+		if err != nil {
+			return err
 		}
+		r.scope.vars[block.Name.Value] = v
+		return nil
+
+	case *ast.MacroBlock, *ast.ImportBlock:
+		// Macros are defined by renderTemplate and render only when called.
 		return nil
 
 	default:
@@ -75,13 +469,23 @@ func (r *renderer) renderBlock(b ast.Block) error {
 	}
 }
 
+// evalExpr evaluates e, reporting errors at the span of the innermost
+// expression that failed.
 func (r renderer) evalExpr(e ast.Expr) (value.Value, error) {
+	v, err := r.eval(e)
+	if err != nil {
+		return nil, positioned(e, err)
+	}
+	return v, nil
+}
+
+func (r renderer) eval(e ast.Expr) (value.Value, error) {
 	switch expr := e.(type) {
 	case *ast.BasicLiteral:
 		return value.FromBasicLit(expr), nil
 
 	case *ast.Identifier:
-		return r.data[expr.Value], nil
+		return r.lookup(expr.Value), nil
 
 	case *ast.BinaryExpr:
 		lOperand, err := r.evalExpr(expr.LOperand)
@@ -92,122 +496,368 @@ func (r renderer) evalExpr(e ast.Expr) (value.Value, error) {
 		if err != nil {
 			return nil, err
 		}
-		switch expr.Operator {
-		case token.TILDE:
-			lOperandValue, err := expectValueType[value.String](lOperand)
-			if err != nil {
-				return nil, err
-			}
-			rOperandValue, err := expectValueType[value.String](rOperand)
-			if err != nil {
-				return nil, err
-			}
-			return lOperandValue.Concat(rOperandValue), nil
+		return binaryOperation(expr.Operator)(lOperand, rOperand)
 
-		case token.KEYWORD_OR:
-			lOperandValue, err := expectValueType[value.Bool](lOperand)
-			if err != nil {
-				return nil, err
-			}
-			rOperandValue, err := expectValueType[value.Bool](rOperand)
-			if err != nil {
-				return nil, err
-			}
-			return lOperandValue.Or(rOperandValue), nil
+	case *ast.UnaryExpr:
+		operand, err := r.evalExpr(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return unaryOperation(expr.Operator)(operand)
+
+	case *ast.ParenExpr:
+		return r.evalExpr(expr.Value)
+
+	case *ast.MemberExpr:
+		object, err := r.evalExpr(expr.Object)
+		if err != nil {
+			return nil, err
+		}
+		m, err := expectValueType[value.Map](object)
+		if err != nil {
+			return nil, err
+		}
+		return m[expr.Member.Value], nil
+
+	case *ast.ListLiteral:
+		elements, err := r.evalExprList(expr.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return value.List(elements), nil
+
+	case *ast.CallExpr:
+		argumentValues, err := r.evalExprList(expr.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return r.evalCall(expr.Function, argumentValues)
+
+	case *ast.PipeExpr:
+		argumentValues, err := r.evalExprList(append([]ast.Expr{expr.Argument}, expr.Arguments...))
+		if err != nil {
+			return nil, err
+		}
+		return r.evalCall(expr.Function, argumentValues)
+
+	case *ast.ConditionalExpr:
+		conditionValue, err := r.evalExpr(expr.Condition)
+		if err != nil {
+			return nil, err
+		}
+		condition, err := expectValueType[value.Bool](conditionValue)
+		if err != nil {
+			return nil, err
+		}
+		// Only the chosen operand is evaluated.
+		if condition {
+			return r.evalExpr(expr.Consequence)
+		}
+		return r.evalExpr(expr.Alternative)
+
+	default:
+		panic(fmt.Sprintf("unexpected ast.Expr: %T", e))
+	}
+}
+
+// display returns the text displaying v, which is escaped unless safe.
+func (o Options) display(v value.Value, safe bool) (string, error) {
+	// Integers are displayed in decimal.
+	if intValue, ok := v.(value.Int); ok {
+		return strconv.FormatInt(int64(intValue), 10), nil
+	}
+	stringValue, err := expectValueType[value.String](v)
+	if err != nil {
+		return "", err
+	}
+	if safe {
+		return string(stringValue), nil
+	}
+	return o.Escape.escape(string(stringValue)), nil
+}
+
+// isSafe reports whether the value of e is displayed without escaping,
+// which is the case for calls to @safe and to the macros.
+func isSafe(e ast.Expr, macros map[string]*ast.MacroBlock) bool {
+	var function ast.Identifier
+	switch expr := e.(type) {
+	case *ast.ParenExpr:
+		return isSafe(expr.Value, macros)
+	case *ast.ConditionalExpr:
+		return isSafe(expr.Consequence, macros) && isSafe(expr.Alternative, macros)
+	case *ast.CallExpr:
+		function = expr.Function
+	case *ast.PipeExpr:
+		function = expr.Function
+	default:
+		return false
+	}
+	if _, ok := macros[function.Value]; ok {
+		return true
+	}
+	return function.Value == "@safe"
+}
 
-		case token.KEYWORD_AND:
-			lOperandValue, err := expectValueType[value.Bool](lOperand)
+// binaryOperation returns the function applying the binary operator to its
+// operands.
+func binaryOperation(operator token.Kind) func(x, y value.Value) (value.Value, error) {
+	switch operator {
+	case token.TILDE:
+		return evalConcat
+	case token.KEYWORD_OR:
+		return evalOr
+	case token.KEYWORD_AND:
+		return evalAnd
+	case token.EQUAL_EQUAL:
+		return evalEqual
+	case token.BANG_EQUAL:
+		return evalNotEqual
+	case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT:
+		return func(x, y value.Value) (value.Value, error) {
+			xInt, err := expectValueType[value.Int](x)
 			if err != nil {
 				return nil, err
 			}
-			rOperandValue, err := expectValueType[value.Bool](rOperand)
+			yInt, err := expectValueType[value.Int](y)
 			if err != nil {
 				return nil, err
 			}
-			return lOperandValue.And(rOperandValue), nil
+			return evalArithmetic(operator, xInt, yInt)
+		}
+	case token.LESS, token.LESS_EQUAL, token.GREATER, token.GREATER_EQUAL:
+		return func(x, y value.Value) (value.Value, error) {
+			return evalOrdering(operator, x, y)
+		}
+	case token.KEYWORD_IN:
+		return evalIn
+	case token.NOT_IN:
+		return evalNotIn
+	default:
+		panic(fmt.Sprintf("unexpected binary operator: %s", operator))
+	}
+}
 
-		case token.EQUAL_EQUAL:
-			if lOperand == nil || rOperand == nil {
-				return nil, nil
-			}
+// unaryOperation returns the function applying the unary operator to its
+// operand.
+func unaryOperation(operator token.Kind) func(x value.Value) (value.Value, error) {
+	switch operator {
+	case token.BANG:
+		return evalNot
+	case token.MINUS:
+		return evalNeg
+	default:
+		panic(fmt.Sprintf("unexpected unary operator: %s", operator))
+	}
+}
 
-			var err error
-			switch lOperand.(type) {
-			case value.Bool:
-				_, err = expectValueType[value.Bool](rOperand)
-			case value.String:
-				_, err = expectValueType[value.String](rOperand)
-			default:
-				panic(fmt.Sprintf("unexpected value.Value: %T", lOperand))
-			}
-			if err != nil {
-				return nil, err
-			}
-			return value.Bool(lOperand == rOperand), nil
+func evalConcat(x, y value.Value) (value.Value, error) {
+	xString, err := expectValueType[value.String](x)
+	if err != nil {
+		return nil, err
+	}
+	yString, err := expectValueType[value.String](y)
+	if err != nil {
+		return nil, err
+	}
+	return xString.Concat(yString), nil
+}
 
-		case token.BANG_EQUAL:
-			if lOperand == nil || rOperand == nil {
-				return nil, nil
-			}
+func evalOr(x, y value.Value) (value.Value, error) {
+	xBool, err := expectValueType[value.Bool](x)
+	if err != nil {
+		return nil, err
+	}
+	yBool, err := expectValueType[value.Bool](y)
+	if err != nil {
+		return nil, err
+	}
+	return xBool.Or(yBool), nil
+}
 
-			var err error
-			switch lOperand.(type) {
-			case value.Bool:
-				_, err = expectValueType[value.Bool](rOperand)
-			case value.String:
-				_, err = expectValueType[value.String](rOperand)
-			default:
-				panic(fmt.Sprintf("unexpected value.Value: %T", lOperand))
-			}
-			if err != nil {
-				return nil, err
-			}
-			return value.Bool(lOperand != rOperand), nil
+func evalAnd(x, y value.Value) (value.Value, error) {
+	xBool, err := expectValueType[value.Bool](x)
+	if err != nil {
+		return nil, err
+	}
+	yBool, err := expectValueType[value.Bool](y)
+	if err != nil {
+		return nil, err
+	}
+	return xBool.And(yBool), nil
+}
 
-		default:
-			panic(fmt.Sprintf("unexpected binary operator: %s", expr.Operator))
-		}
+func evalNot(x value.Value) (value.Value, error) {
+	xBool, err := expectValueType[value.Bool](x)
+	if err != nil {
+		return nil, err
+	}
+	return !xBool, nil
+}
 
-	case *ast.UnaryExpr:
-		operand, err := r.evalExpr(expr.Operand)
+func evalNeg(x value.Value) (value.Value, error) {
+	xInt, err := expectValueType[value.Int](x)
+	if err != nil {
+		return nil, err
+	}
+	return xInt.Neg()
+}
+
+func evalArithmetic(operator token.Kind, x, y value.Int) (value.Value, error) {
+	switch operator {
+	case token.PLUS:
+		return x.Add(y)
+	case token.MINUS:
+		return x.Sub(y)
+	case token.STAR:
+		return x.Mul(y)
+	case token.SLASH:
+		return x.Div(y)
+	case token.PERCENT:
+		return x.Rem(y)
+	default:
+		panic(fmt.Sprintf("unexpected arithmetic operator: %s", operator))
+	}
+}
+
+// evalOrdering compares two integers or two strings. The type of an
+// undefined operand is taken from the other one.
+func evalOrdering(operator token.Kind, x, y value.Value) (value.Value, error) {
+	operand := x
+	if operand == nil {
+		operand = y
+	}
+
+	var less, greater value.Bool
+	switch operand.(type) {
+	case nil:
+		return nil, nil
+	case value.Int:
+		xInt, err := expectValueType[value.Int](x)
+		if err != nil {
+			return nil, err
+		}
+		yInt, err := expectValueType[value.Int](y)
 		if err != nil {
 			return nil, err
 		}
+		less, greater = xInt.Less(yInt), yInt.Less(xInt)
+	case value.String:
+		xString, err := expectValueType[value.String](x)
+		if err != nil {
+			return nil, err
+		}
+		yString, err := expectValueType[value.String](y)
+		if err != nil {
+			return nil, err
+		}
+		less, greater = xString.Less(yString), yString.Less(xString)
+	default:
+		return nil, fmt.Errorf("operator %s is not defined on %s", operator, operand.Type())
+	}
 
-		switch expr.Operator {
-		case token.BANG:
-			operandBool, err := expectValueType[value.Bool](operand)
-			if err != nil {
-				return nil, err
-			}
-			return !operandBool, nil
+	switch operator {
+	case token.LESS:
+		return less, nil
+	case token.LESS_EQUAL:
+		return !greater, nil
+	case token.GREATER:
+		return greater, nil
+	case token.GREATER_EQUAL:
+		return !less, nil
+	default:
+		panic(fmt.Sprintf("unexpected ordering operator: %s", operator))
+	}
+}
 
-		default:
-			panic(fmt.Sprintf("unexpected unary operator: %s", expr.Operator))
-		}
+// evalEqual reports whether x and y are equal. Only booleans, strings and
+// integers can be compared. The result is undefined if any operand is
+// undefined.
+func evalEqual(x, y value.Value) (value.Value, error) {
+	if x == nil || y == nil {
+		return nil, nil
+	}
 
-	case *ast.ParenExpr:
-		return r.evalExpr(expr.Value)
+	var err error
+	switch x.(type) {
+	case value.Bool:
+		_, err = expectValueType[value.Bool](y)
+	case value.String:
+		_, err = expectValueType[value.String](y)
+	case value.Int:
+		_, err = expectValueType[value.Int](y)
+	default:
+		return nil, fmt.Errorf("cannot compare %s values", x.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value.Bool(x == y), nil
+}
 
-	case *ast.CallExpr:
-		argumentValues, err := r.evalExprList(expr.Arguments)
+func evalNotEqual(x, y value.Value) (value.Value, error) {
+	eq, err := evalEqual(x, y)
+	if eq == nil || err != nil {
+		return nil, err
+	}
+	return !eq.(value.Bool), nil
+}
+
+// matchCase reports whether v equals any of the values of a case.
+func (r *renderer) matchCase(v value.Value, values []ast.Expr) (bool, error) {
+	for _, e := range values {
+		caseValue, err := r.evalExpr(e)
 		if err != nil {
-			return nil, err
+			return false, err
 		}
-		return r.evalCall(expr.Function, argumentValues)
+		eq, err := evalEqual(v, caseValue)
+		if err != nil {
+			return false, err
+		}
+		if eq == value.Bool(true) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	case *ast.PipeExpr:
-		argument, err := r.evalExpr(expr.Argument)
+// evalIn reports whether x is a substring of the string y or an element of
+// the list y.
+func evalIn(x, y value.Value) (value.Value, error) {
+	if x == nil || y == nil {
+		return nil, nil
+	}
+	switch container := y.(type) {
+	case value.String:
+		s, err := expectValueType[value.String](x)
 		if err != nil {
 			return nil, err
 		}
-		return r.evalCall(expr.Function, []value.Value{argument})
-
+		return value.Bool(strings.Contains(string(container), string(s))), nil
+	case value.List:
+		switch x.(type) {
+		case value.Bool, value.String, value.Int:
+		default:
+			return nil, fmt.Errorf("cannot compare %s values", x.Type())
+		}
+		for _, elem := range container {
+			if elem == x {
+				return value.Bool(true), nil
+			}
+		}
+		return value.Bool(false), nil
 	default:
-		panic(fmt.Sprintf("unexpected ast.Expr: %T", e))
+		return nil, fmt.Errorf("operator in is not defined on %s", y.Type())
 	}
 }
 
+func evalNotIn(x, y value.Value) (value.Value, error) {
+	in, err := evalIn(x, y)
+	if in == nil || err != nil {
+		return nil, err
+	}
+	return !in.(value.Bool), nil
+}
+
 func (r renderer) evalExprList(exprList []ast.Expr) ([]value.Value, error) {
 	values := make([]value.Value, 0, len(exprList))
 	for _, expr := range exprList {
@@ -221,6 +871,10 @@ func (r renderer) evalExprList(exprList []ast.Expr) ([]value.Value, error) {
 }
 
 func (r renderer) evalCall(functionIdentifier ast.Identifier, argumentValues []value.Value) (value.Value, error) {
+	if macro, ok := r.macros[functionIdentifier.Value]; ok {
+		return r.callMacro(macro, argumentValues)
+	}
+
 	function, err := builtin.LookupFunction(functionIdentifier)
 	if err != nil {
 		return nil, err
@@ -234,6 +888,38 @@ func (r renderer) evalCall(functionIdentifier ast.Identifier, argumentValues []v
 	return function.Call(argumentValues)
 }
 
+// callMacro renders the body of macro with its parameters bound to args.
+func (r renderer) callMacro(macro *ast.MacroBlock, args []value.Value) (value.Value, error) {
+	if len(macro.Parameters) != len(args) {
+		return nil, fmt.Errorf("macro %s expects %d arguments, got %d",
+			macro.Name.Value, len(macro.Parameters), len(args))
+	}
+	if r.depth >= maxMacroDepth {
+		return nil, fmt.Errorf("macro %s: maximum call depth exceeded", macro.Name.Value)
+	}
+
+	vars := make(map[string]value.Value, len(args))
+	for i, parameter := range macro.Parameters {
+		vars[parameter.Value] = args[i]
+	}
+	// Macros see their parameters and the template data, but not the
+	// variables bound at the call site.
+	m := renderer{
+		options:   r.options,
+		data:      r.data,
+		scope:     &scope{vars: vars},
+		includes:  r.includes,
+		overrides: r.overrides,
+		macros:    r.macros,
+		depth:     r.depth + 1,
+	}
+	if err := m.renderBlocks(macro.Body,
+		statementEdge(macro.Trim.Right), statementEdge(macro.EndTrim.Left)); err != nil {
+		return nil, err
+	}
+	return value.String(m.buffer.String()), nil
+}
+
 func expectValueType[T value.Value](val value.Value) (valT T, err error) {
 	if val == nil {
 		return
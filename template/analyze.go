@@ -9,6 +9,7 @@ import (
 
 func (t Template) Analyze() (map[string]value.Type, []analysis.Diagnostic) {
 	analyzer := analysis.NewAnalyzer()
+	analyzer.Include = t.Include
 
 	// TODO(skewb1k): process files concurrently.
 	onFile := func(f *File, parent string) error {
@@ -0,0 +1,66 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/render"
+)
+
+// ConfigFile is the name of the optional file configuring the templates in
+// its directory.
+const ConfigFile = "_config.json"
+
+// Config is the configuration of a template, read from its [ConfigFile].
+type Config struct {
+	// Delimiters are the delimiters of tags, written as accepted by
+	// [parse.ParseDelimiters].
+	Delimiters parse.Delimiters `json:"delimiters"`
+	// Escape maps patterns, as accepted by [path.Match], of the paths of
+	// files relative to the template to the escaping of their output,
+	// overriding the escaping chosen from the output extension.
+	Escape map[string]render.Escape `json:"escape"`
+}
+
+// escapeFor returns the escaping configured for the file at path, a
+// slash-separated path relative to the template, or nil if there is none.
+// Patterns are tried in lexical order.
+func (c Config) escapeFor(name string) (*render.Escape, error) {
+	for _, pattern := range slices.Sorted(maps.Keys(c.Escape)) {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ConfigFile, err)
+		}
+		if matched {
+			escape := c.Escape[pattern]
+			return &escape, nil
+		}
+	}
+	return nil, nil
+}
+
+// LoadConfig reads the [ConfigFile] in the directory dir. It returns the
+// zero Config if the file does not exist.
+func LoadConfig(dir string) (Config, error) {
+	var config Config
+	path := filepath.Join(dir, ConfigFile)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
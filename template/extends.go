@@ -0,0 +1,33 @@
+package template
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/value"
+)
+
+// ResolveExtends loads the base templates of f and of its ancestors with
+// include, linking them through [ast.ExtendsBlock.Base].
+func ResolveExtends(f *ast.Template, include func(name string) (*ast.Template, error)) error {
+	var chain []string
+	for extends := f.Extends(); extends != nil; extends = f.Extends() {
+		name := string(value.FromBasicLit(&extends.Path).(value.String))
+		if slices.Contains(chain, name) {
+			return fmt.Errorf("extends cycle: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+		chain = append(chain, name)
+
+		if extends.Base == nil {
+			base, err := include(name)
+			if err != nil {
+				return err
+			}
+			extends.Base = base
+		}
+		f = extends.Base
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+)
+
+// PartialsDir is the name of the directory next to the templates that holds
+// partials shared by all of them.
+const PartialsDir = "_partials"
+
+// IncludeFrom returns a function that loads partial templates like
+// [Template.Include] for the template in the directory root, parsing them
+// with options.
+func IncludeFrom(root string, options parse.Options) func(name string) (*ast.Template, error) {
+	t := Template{
+		root:         root,
+		parseOptions: options,
+		partials:     make(map[string]*ast.Template),
+	}
+	return t.Include
+}
+
+// Include returns the partial template name. It is resolved relative to the
+// root of the template first, and then to the shared [PartialsDir]. Parsed
+// partials are cached.
+func (t Template) Include(name string) (*ast.Template, error) {
+	if partial, ok := t.partials[name]; ok {
+		return partial, nil
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("cannot include %q: path must be relative to the template", name)
+	}
+
+	candidates := [...]string{
+		filepath.Join(t.root, name),
+		filepath.Join(filepath.Dir(t.root), PartialsDir, name),
+	}
+	for _, path := range candidates {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		partial, err := t.parseOptions.File(path, content)
+		if err != nil {
+			return nil, err
+		}
+		t.partials[name] = partial
+		if err := ResolveExtends(partial, t.Include); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return partial, nil
+	}
+	return nil, fmt.Errorf("cannot include %q: file not found", name)
+}
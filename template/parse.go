@@ -1,28 +1,127 @@
 package template
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"github.com/vietmpl/vie/ast"
 	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/value"
 )
 
-func FromDir(path string) (*Template, error) {
+// FromDir loads the template in the directory path. Tags are delimited by
+// delimiters, or if it is the zero value, by the delimiters set in the
+// [ConfigFile] of the template.
+func FromDir(path string, delimiters parse.Delimiters) (*Template, error) {
 	parent := filepath.Dir(path)
 	name := filepath.Base(path)
 
-	rootDir, err := parseDir(parent, name)
+	config, err := LoadConfig(path)
 	if err != nil {
 		return nil, err
 	}
-	return &Template{
-		Name:  name,
-		Files: rootDir.Files,
-		Dirs:  rootDir.Dirs,
-	}, nil
+	if delimiters == (parse.Delimiters{}) {
+		delimiters = config.Delimiters
+	}
+	options := parse.Options{Delimiters: delimiters}
+
+	rootDir, err := parseDir(options, parent, name, true)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{
+		Name:         name,
+		Files:        rootDir.Files,
+		Dirs:         rootDir.Dirs,
+		root:         path,
+		parseOptions: options,
+		partials:     make(map[string]*ast.Template),
+	}
+
+	onFile := func(f *File, parent string) error {
+		if f.ContentTemplate == nil {
+			return nil
+		}
+		path := filepath.Join(parent, f.Name)
+		if err := ResolveExtends(f.ContentTemplate, t.Include); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		escape, err := config.escapeFor(filepath.ToSlash(path))
+		if err != nil {
+			return err
+		}
+		f.Escape = escape
+		return nil
+	}
+	onDir := func(d *Dir, parent string) error {
+		return nil
+	}
+	if err := t.Walk(onDir, onFile); err != nil {
+		return nil, err
+	}
+
+	// Files included, imported or extended by the others are partials
+	// rather than files of the output.
+	targets := make(map[string]bool)
+	onFile = func(f *File, parent string) error {
+		if f.ContentTemplate != nil {
+			t.collectTargets(f.ContentTemplate, targets)
+		}
+		return nil
+	}
+	if err := t.Walk(onDir, onFile); err != nil {
+		return nil, err
+	}
+	t.Files, t.Dirs = removeTargets(t.Files, t.Dirs, "", targets)
+	return t, nil
+}
+
+// collectTargets adds the paths of the templates included, imported or
+// extended by f, and by those templates in turn, to targets. Templates that
+// fail to load are left for rendering to report.
+func (t Template) collectTargets(f *ast.Template, targets map[string]bool) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		var path *ast.BasicLiteral
+		switch n := n.(type) {
+		case *ast.IncludeBlock:
+			path = &n.Path
+		case *ast.ImportBlock:
+			path = &n.Path
+		case *ast.ExtendsBlock:
+			path = &n.Path
+		default:
+			return true
+		}
+		name := string(value.FromBasicLit(path).(value.String))
+		if key := filepath.Clean(filepath.FromSlash(name)); !targets[key] {
+			targets[key] = true
+			if partial, err := t.Include(name); err == nil {
+				t.collectTargets(partial, targets)
+			}
+		}
+		return true
+	})
 }
 
-func parseDir(parent, dirName string) (*Dir, error) {
+// removeTargets removes the files whose paths relative to the root of the
+// template are in targets from files and dirs, which are in the directory
+// parent.
+func removeTargets(files []*File, dirs []*Dir, parent string, targets map[string]bool) ([]*File, []*Dir) {
+	files = slices.DeleteFunc(files, func(f *File) bool {
+		return targets[filepath.Join(parent, f.Name)]
+	})
+	for _, d := range dirs {
+		d.Files, d.Dirs = removeTargets(d.Files, d.Dirs, filepath.Join(parent, d.Name), targets)
+	}
+	return files, dirs
+}
+
+// parseDir parses the directory dirName in parent. The config file and
+// shared partials are not files of the output, and are skipped in the root
+// directory of the template.
+func parseDir(options parse.Options, parent, dirName string, root bool) (*Dir, error) {
 	dirPath := filepath.Join(parent, dirName)
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -36,20 +135,23 @@ func parseDir(parent, dirName string) (*Dir, error) {
 
 	for _, entry := range entries {
 		name := entry.Name()
+		if root && (name == ConfigFile || name == PartialsDir) {
+			continue
+		}
 		// TODO(skewb1k): allow only specific subset of syntax in name.
-		nameAST, err := parse.Source([]byte(name))
+		path := filepath.Join(dirPath, name)
+		nameAST, err := options.File(path, []byte(name))
 		if err != nil {
 			return nil, err
 		}
 		if entry.IsDir() {
-			subDir, err := parseDir(dirPath, name)
+			subDir, err := parseDir(options, dirPath, name, false)
 			if err != nil {
 				return nil, err
 			}
 			subDir.NameTemplate = nameAST
 			dir.Dirs = append(dir.Dirs, subDir)
 		} else {
-			path := filepath.Join(dirPath, name)
 			content, err := os.ReadFile(path)
 			if err != nil {
 				return nil, err
@@ -62,7 +164,7 @@ func parseDir(parent, dirName string) (*Dir, error) {
 			f.Content = content
 			// Parse file content if its Vie file
 			if filepath.Ext(name) == ".vie" {
-				contentAST, err := parse.Source(content)
+				contentAST, err := options.File(path, content)
 				if err != nil {
 					return nil, err
 				}
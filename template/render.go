@@ -12,18 +12,30 @@ import (
 func (t Template) Render(data map[string]value.Value) (map[string][]byte, error) {
 	files := make(map[string][]byte)
 
+	options := t.Options
+	if options.Include == nil {
+		options.Include = t.Include
+	}
+
 	onFile := func(f *File, parent string) error {
-		name, err := render.Template(f.NameTemplate, data)
+		source := filepath.Join(parent, f.Name)
+		name, err := options.Template(f.NameTemplate, data)
 		if err != nil {
-			return err
+			return render.WithPath(source, err)
 		}
 		path := filepath.Join(parent, string(name))
 
 		if f.ContentTemplate != nil {
 			path = strings.TrimSuffix(path, ".vie")
-			content, err := render.Template(f.ContentTemplate, data)
+			options := options
+			if f.Escape != nil {
+				options.Escape = *f.Escape
+			} else {
+				options.Escape = render.EscapeFor(path)
+			}
+			content, err := options.Template(f.ContentTemplate, data)
 			if err != nil {
-				return err
+				return render.WithPath(source, err)
 			}
 			if _, ok := files[path]; ok {
 				return fmt.Errorf("%s conflicts", path)
@@ -36,9 +48,9 @@ func (t Template) Render(data map[string]value.Value) (map[string][]byte, error)
 	}
 
 	onDir := func(d *Dir, parent string) error {
-		name, err := render.Template(d.NameTemplate, data)
+		name, err := options.Template(d.NameTemplate, data)
 		if err != nil {
-			return err
+			return render.WithPath(filepath.Join(parent, d.Name), err)
 		}
 		d.Name = string(name)
 		return nil
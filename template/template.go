@@ -1,11 +1,22 @@
 package template
 
-import "github.com/vietmpl/vie/ast"
+import (
+	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/parse"
+	"github.com/vietmpl/vie/render"
+)
 
 type Template struct {
 	Name  string
 	Files []*File
 	Dirs  []*Dir
+	// Options configures how the files of the template are rendered. The
+	// escaping is chosen for each file, see [File.Escape].
+	Options render.Options
+
+	root         string
+	parseOptions parse.Options
+	partials     map[string]*ast.Template
 }
 
 type Dir struct {
@@ -20,4 +31,7 @@ type File struct {
 	NameTemplate    *ast.Template
 	Content         []byte
 	ContentTemplate *ast.Template
+	// Escape is the escaping of the rendered content. If it is nil, the
+	// escaping is chosen from the extension of the output file.
+	Escape *render.Escape
 }
@@ -0,0 +1,114 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A LiteralError reports an invalid string literal.
+type LiteralError struct {
+	// Offset is the byte offset of the error in the literal.
+	Offset int
+	Msg    string
+}
+
+func (e *LiteralError) Error() string {
+	return e.Msg
+}
+
+// Unquote returns the value of the string literal s.
+//
+// Literals enclosed in double or single quotes cannot contain line breaks
+// and interpret the escape sequences \n, \t, \r, \\, \", \' and \uXXXX,
+// where XXXX are four hexadecimal digits of a Unicode code point. Literals
+// enclosed in backticks are raw: their content is taken as is.
+//
+// If s is not a valid literal, the error is a [*LiteralError].
+func Unquote(s string) (string, error) {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", &LiteralError{Offset: 0, Msg: "string literal not terminated"}
+	}
+	quote := s[0]
+	content := s[1 : len(s)-1]
+	switch quote {
+	case '`':
+		if i := strings.IndexByte(content, '`'); i >= 0 {
+			return "", &LiteralError{Offset: 1 + i, Msg: "unexpected ` in raw string literal"}
+		}
+		return content, nil
+	case '"', '\'':
+	default:
+		return "", &LiteralError{Offset: 0, Msg: "expected string literal"}
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	for i := 0; i < len(content); {
+		offset := 1 + i
+		c := content[i]
+		switch c {
+		case quote:
+			return "", &LiteralError{Offset: offset, Msg: fmt.Sprintf("unexpected %c in string literal", quote)}
+		case '\n', '\r':
+			return "", &LiteralError{Offset: offset, Msg: "line break in string literal"}
+		case '\\':
+		default:
+			b.WriteByte(c)
+			i++
+			continue
+		}
+
+		if i+1 == len(content) {
+			return "", &LiteralError{Offset: offset, Msg: "string literal not terminated"}
+		}
+		switch e := content[i+1]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\', '"', '\'':
+			b.WriteByte(e)
+		case 'u':
+			r, ok := unquoteHex(content[i+2:])
+			if !ok {
+				return "", &LiteralError{Offset: offset, Msg: "invalid \\u escape sequence: expected 4 hexadecimal digits"}
+			}
+			if !utf8.ValidRune(r) {
+				return "", &LiteralError{Offset: offset, Msg: fmt.Sprintf("invalid \\u escape sequence: %U is not a valid code point", r)}
+			}
+			b.WriteRune(r)
+			i += 4
+		default:
+			r, _ := utf8.DecodeRuneInString(content[i+1:])
+			return "", &LiteralError{Offset: offset, Msg: fmt.Sprintf("unknown escape sequence \\%c", r)}
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// unquoteHex decodes the four hexadecimal digits at the start of s.
+func unquoteHex(s string) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range []byte(s[:4]) {
+		var digit byte
+		switch {
+		case '0' <= c && c <= '9':
+			digit = c - '0'
+		case 'a' <= c && c <= 'f':
+			digit = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			digit = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(digit)
+	}
+	return r, true
+}
@@ -0,0 +1,73 @@
+package token_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vietmpl/vie/token"
+)
+
+var unquoteTests = [...]struct {
+	literal  string
+	expected string
+}{
+	{`""`, ""},
+	{`"abc"`, "abc"},
+	{`'abc'`, "abc"},
+	{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+	{`"\\ \" \'"`, `\ " '`},
+	{`'it\'s "quoted"'`, `it's "quoted"`},
+	{`"\u00e9\u4E16"`, "é世"},
+	{"`a\\n\"b'`", `a\n"b'`},
+	{"`line 1\nline 2`", "line 1\nline 2"},
+	{`"世界"`, "世界"},
+}
+
+var unquoteErrorTests = [...]struct {
+	literal string
+	offset  int
+}{
+	{`"`, 0},
+	{`"abc`, 0},
+	{`abc`, 0},
+	{`'abc"`, 0},
+	{`"a"b"`, 2},
+	{`"a\qb"`, 2},
+	{`"\u12"`, 1},
+	{`"\u12g4"`, 1},
+	{`"\ud800"`, 1},
+	{"\"a\nb\"", 2},
+	{`"a\"`, 2},
+	{"`a`b`", 2},
+}
+
+func TestUnquote(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range unquoteTests {
+		t.Run(test.literal, func(t *testing.T) {
+			t.Parallel()
+			actual, err := token.Unquote(test.literal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expected != actual {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+
+	for _, test := range unquoteErrorTests {
+		t.Run(test.literal, func(t *testing.T) {
+			t.Parallel()
+			_, err := token.Unquote(test.literal)
+			var litErr *token.LiteralError
+			if !errors.As(err, &litErr) {
+				t.Fatalf("expected *token.LiteralError, got %v", err)
+			}
+			if test.offset != litErr.Offset {
+				t.Errorf("expected offset %d, got %d (%s)", test.offset, litErr.Offset, litErr.Msg)
+			}
+		})
+	}
+}
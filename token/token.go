@@ -2,6 +2,8 @@
 // of the Vie template language.
 package token
 
+import "fmt"
+
 // Kind identifies the type of a lexical token.
 type Kind uint8
 
@@ -12,6 +14,7 @@ const (
 	COMMENT
 	IDENTIFIER
 	STRING_LITERAL
+	INT_LITERAL
 	L_BRACE_PERCENT
 	R_BRACE_PERCENT
 	L_BRACE_POUND
@@ -20,17 +23,47 @@ const (
 	R_DOUBLE_BRACE
 	L_PAREN
 	R_PAREN
+	L_BRACKET
+	R_BRACKET
+	COMMA
+	COLON
+	DOT
 	BANG
 	BANG_EQUAL
+	EQUAL
 	EQUAL_EQUAL
 	PIPE
 	TILDE
+	PLUS
+	MINUS
+	STAR
+	SLASH
+	PERCENT
+	LESS
+	LESS_EQUAL
+	GREATER
+	GREATER_EQUAL
+	QUESTION
+	NOT_IN
 	KEYWORD_AND
+	KEYWORD_BLOCK
+	KEYWORD_CASE
+	KEYWORD_DEFAULT
 	KEYWORD_ELSE
 	KEYWORD_ELSEIF
 	KEYWORD_END
+	KEYWORD_EXTENDS
+	KEYWORD_FOR
 	KEYWORD_IF
+	KEYWORD_IMPORT
+	KEYWORD_IN
+	KEYWORD_INCLUDE
+	KEYWORD_MACRO
+	KEYWORD_NOT
 	KEYWORD_OR
+	KEYWORD_RAW
+	KEYWORD_SET
+	KEYWORD_SWITCH
 )
 
 // String returns the human-readable representation of the token kind.
@@ -38,6 +71,23 @@ func (k Kind) String() string {
 	return kindToString[k]
 }
 
+// MarshalText implements [encoding.TextMarshaler], encoding k as its
+// [Kind.String] representation.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (k *Kind) UnmarshalText(text []byte) error {
+	for kind, s := range kindToString {
+		if s == string(text) {
+			*k = Kind(kind)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token kind %q", text)
+}
+
 var kindToString = [...]string{
 	ERROR:           "ERROR",
 	EOF:             "EOF",
@@ -45,6 +95,7 @@ var kindToString = [...]string{
 	COMMENT:         "COMMENT",
 	IDENTIFIER:      "IDENTIFIER",
 	STRING_LITERAL:  "STRING_LITERAL",
+	INT_LITERAL:     "INT_LITERAL",
 	L_BRACE_PERCENT: "{%",
 	R_BRACE_PERCENT: "%}",
 	L_BRACE_POUND:   "{#",
@@ -53,15 +104,62 @@ var kindToString = [...]string{
 	R_DOUBLE_BRACE:  "}}",
 	L_PAREN:         "(",
 	R_PAREN:         ")",
+	L_BRACKET:       "[",
+	R_BRACKET:       "]",
+	COMMA:           ",",
+	COLON:           ":",
+	DOT:             ".",
 	BANG:            "!",
 	BANG_EQUAL:      "!=",
+	EQUAL:           "=",
 	EQUAL_EQUAL:     "==",
 	PIPE:            "|",
 	TILDE:           "~",
+	PLUS:            "+",
+	MINUS:           "-",
+	STAR:            "*",
+	SLASH:           "/",
+	PERCENT:         "%",
+	LESS:            "<",
+	LESS_EQUAL:      "<=",
+	GREATER:         ">",
+	GREATER_EQUAL:   ">=",
+	QUESTION:        "?",
+	NOT_IN:          "not in",
 	KEYWORD_AND:     "and",
+	KEYWORD_BLOCK:   "block",
+	KEYWORD_CASE:    "case",
+	KEYWORD_DEFAULT: "default",
 	KEYWORD_ELSE:    "else",
 	KEYWORD_ELSEIF:  "elseif",
 	KEYWORD_END:     "end",
+	KEYWORD_EXTENDS: "extends",
+	KEYWORD_FOR:     "for",
 	KEYWORD_IF:      "if",
+	KEYWORD_IMPORT:  "import",
+	KEYWORD_IN:      "in",
+	KEYWORD_INCLUDE: "include",
+	KEYWORD_MACRO:   "macro",
+	KEYWORD_NOT:     "not",
 	KEYWORD_OR:      "or",
+	KEYWORD_RAW:     "raw",
+	KEYWORD_SET:     "set",
+	KEYWORD_SWITCH:  "switch",
+}
+
+var keywords = func() map[string]Kind {
+	m := make(map[string]Kind)
+	for k := KEYWORD_AND; k <= KEYWORD_SWITCH; k++ {
+		m[k.String()] = k
+	}
+	return m
+}()
+
+// Lookup returns the keyword kind of ident, or IDENTIFIER if ident is not a
+// keyword.
+func Lookup(ident string) Kind {
+	if kind, ok := keywords[ident]; ok {
+		return kind
+	}
+	return IDENTIFIER
 }
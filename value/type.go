@@ -1,16 +1,29 @@
 package value
 
-import "fmt"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Type describes the type of a [Value].
+type Type interface {
+	String() string
+	typeNode()
+}
 
-type Type uint8
+// BasicType is the type of a value that is not composed of other values.
+type BasicType uint8
 
 const (
-	TypeString Type = iota
+	TypeString BasicType = iota
 	TypeBool
 	TypeFunction
+	TypeInt
 )
 
-func (t Type) String() string {
+func (t BasicType) String() string {
 	switch t {
 	case TypeString:
 		return "string"
@@ -18,7 +31,130 @@ func (t Type) String() string {
 		return "bool"
 	case TypeFunction:
 		return "function"
+	case TypeInt:
+		return "int"
+	default:
+		panic(fmt.Sprintf("unexpected BasicType value: %d", t))
+	}
+}
+
+// ListType is the type of a list whose elements have type Elem. A nil Elem
+// means the element type is unknown, e.g. for an empty list.
+type ListType struct {
+	Elem Type
+}
+
+func (t ListType) String() string {
+	if t.Elem == nil {
+		return "list"
+	}
+	return "list of " + t.Elem.String()
+}
+
+// MapType is the type of a map from field names to values. Fields holds the
+// types of the known fields; it is a pointer to keep MapType comparable and
+// is nil when the fields are unknown.
+type MapType struct {
+	Fields *map[string]Type
+}
+
+func (t MapType) String() string {
+	if t.Fields == nil {
+		return "map"
+	}
+	var b strings.Builder
+	b.WriteString("map {")
+	for i, name := range slices.Sorted(maps.Keys(*t.Fields)) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString((*t.Fields)[name].String())
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (BasicType) typeNode() {}
+func (ListType) typeNode()  {}
+func (MapType) typeNode()   {}
+
+// Compatible reports whether types x and y agree. A list with an unknown
+// element type is compatible with any list, and a map with unknown fields is
+// compatible with any map.
+func Compatible(x, y Type) bool {
+	switch xx := x.(type) {
+	case ListType:
+		yy, ok := y.(ListType)
+		if !ok {
+			return false
+		}
+		if xx.Elem == nil || yy.Elem == nil {
+			return true
+		}
+		return Compatible(xx.Elem, yy.Elem)
+
+	case MapType:
+		yy, ok := y.(MapType)
+		if !ok {
+			return false
+		}
+		if xx.Fields == nil || yy.Fields == nil {
+			return true
+		}
+		if len(*xx.Fields) != len(*yy.Fields) {
+			return false
+		}
+		for name, xt := range *xx.Fields {
+			yt, ok := (*yy.Fields)[name]
+			if !ok || !Compatible(xt, yt) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return x == y
+	}
+}
+
+// HasType reports whether v is a value of type t. Unlike comparing against
+// v.Type(), it checks every element of a list and every known field of a
+// map.
+func HasType(v Value, t Type) bool {
+	switch tt := t.(type) {
+	case ListType:
+		list, ok := v.(List)
+		if !ok {
+			return false
+		}
+		if tt.Elem == nil {
+			return true
+		}
+		for _, elem := range list {
+			if !HasType(elem, tt.Elem) {
+				return false
+			}
+		}
+		return true
+
+	case MapType:
+		m, ok := v.(Map)
+		if !ok {
+			return false
+		}
+		if tt.Fields == nil {
+			return true
+		}
+		for name, ft := range *tt.Fields {
+			if !HasType(m[name], ft) {
+				return false
+			}
+		}
+		return true
+
 	default:
-		panic(fmt.Sprintf("unexpected Type value: %d", t))
+		return v != nil && v.Type() == t
 	}
 }
@@ -1,10 +1,15 @@
 package value
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"strconv"
 
 	"github.com/vietmpl/vie/ast"
+	"github.com/vietmpl/vie/token"
 )
 
 type Value interface {
@@ -19,13 +24,37 @@ type Bool bool
 
 func (Bool) Type() Type { return TypeBool }
 
+type Int int64
+
+func (Int) Type() Type { return TypeInt }
+
+type List []Value
+
+// Type returns the type of the list, taking the element type from its first
+// element.
+func (x List) Type() Type {
+	if len(x) == 0 {
+		return ListType{}
+	}
+	return ListType{Elem: x[0].Type()}
+}
+
+// Map is a record of named values, accessed with dotted field syntax.
+type Map map[string]Value
+
+func (Map) Type() Type { return MapType{} }
+
 func FromBasicLit(l *ast.BasicLiteral) Value {
 	switch l.Kind {
 	case ast.KindBool:
 		return Bool(l.Value == "true")
+	case ast.KindInt:
+		// The parser guarantees that the literal is in range.
+		value, _ := strconv.ParseInt(l.Value, 10, 64)
+		return Int(value)
 	case ast.KindString:
-		// TODO(skewb1k): Replace this hack with a manual parser.
-		value, _ := strconv.Unquote(l.Value)
+		// The parser guarantees that the literal is valid.
+		value, _ := token.Unquote(l.Value)
 		return String(value)
 	default:
 		panic("value: unsupported literal kind")
@@ -35,6 +64,74 @@ func FromBasicLit(l *ast.BasicLiteral) Value {
 func (x String) Eq(y String) Bool       { return x == y }
 func (x String) Neq(y String) Bool      { return x != y }
 func (x String) Concat(y String) String { return x + y }
+func (x String) Less(y String) Bool     { return x < y }
+
+func (x Int) Eq(y Int) Bool   { return x == y }
+func (x Int) Neq(y Int) Bool  { return x != y }
+func (x Int) Less(y Int) Bool { return x < y }
+
+// Neg returns -x. It returns an error if the result overflows.
+func (x Int) Neg() (Int, error) {
+	if x == math.MinInt64 {
+		return 0, errOverflow
+	}
+	return -x, nil
+}
+
+// Add returns x+y. It returns an error if the result overflows.
+func (x Int) Add(y Int) (Int, error) {
+	z := x + y
+	if (z > x) != (y > 0) {
+		return 0, errOverflow
+	}
+	return z, nil
+}
+
+// Sub returns x-y. It returns an error if the result overflows.
+func (x Int) Sub(y Int) (Int, error) {
+	z := x - y
+	if (z < x) != (y > 0) {
+		return 0, errOverflow
+	}
+	return z, nil
+}
+
+// Mul returns x*y. It returns an error if the result overflows.
+func (x Int) Mul(y Int) (Int, error) {
+	if x == 0 || y == 0 {
+		return 0, nil
+	}
+	z := x * y
+	if z/y != x || y == -1 && x == math.MinInt64 {
+		return 0, errOverflow
+	}
+	return z, nil
+}
+
+// Div returns the quotient x/y truncated towards zero. It returns an error if
+// y is zero or the result overflows.
+func (x Int) Div(y Int) (Int, error) {
+	if y == 0 {
+		return 0, errDivisionByZero
+	}
+	if x == math.MinInt64 && y == -1 {
+		return 0, errOverflow
+	}
+	return x / y, nil
+}
+
+// Rem returns the remainder x%y. It returns an error if y is zero.
+func (x Int) Rem(y Int) (Int, error) {
+	if y == 0 {
+		return 0, errDivisionByZero
+	}
+	return x % y, nil
+}
+
+var (
+	errDivisionByZero = errors.New("integer division by zero")
+	errOverflow       = errors.New("integer overflow")
+)
 
 func (x Bool) Eq(y Bool) Bool  { return x == y }
 func (x Bool) Neq(y Bool) Bool { return x != y }
@@ -64,9 +161,37 @@ func (f *Function) Call(args []Value) (Value, error) {
 		return nil, fmt.Errorf("function %s expects %d arguments, got %d", f.Name, len(f.ArgTypes), len(args))
 	}
 	for i, arg := range args {
-		if arg.Type() != f.ArgTypes[i] {
-			return nil, fmt.Errorf("argument %d: expected %v, got %v", i, f.ArgTypes[i], arg.Type())
+		if !HasType(arg, f.ArgTypes[i]) {
+			return nil, fmt.Errorf("argument %d: %w", i, mismatch(arg, f.ArgTypes[i]))
 		}
 	}
 	return f.Impl(args), nil
 }
+
+// mismatch returns the error for v not having type t, locating the element
+// or field that does not match in lists and maps, whose types do not
+// describe all of their contents.
+func mismatch(v Value, t Type) error {
+	switch tt := t.(type) {
+	case ListType:
+		if list, ok := v.(List); ok {
+			for i, elem := range list {
+				if !HasType(elem, tt.Elem) {
+					return fmt.Errorf("element %d: %w", i, mismatch(elem, tt.Elem))
+				}
+			}
+		}
+	case MapType:
+		if m, ok := v.(Map); ok && tt.Fields != nil {
+			for _, name := range slices.Sorted(maps.Keys(*tt.Fields)) {
+				if !HasType(m[name], (*tt.Fields)[name]) {
+					return fmt.Errorf("field %s: %w", name, mismatch(m[name], (*tt.Fields)[name]))
+				}
+			}
+		}
+	}
+	if v == nil {
+		return fmt.Errorf("expected %v, got nothing", t)
+	}
+	return fmt.Errorf("expected %v, got %v", t, v.Type())
+}